@@ -0,0 +1,353 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// FileName is the config file looked for in the working directory
+const FileName = "ddollar.toml"
+
+// Config is the contents of a ddollar config file. Zero values mean
+// "not set": flags override the file, and the file overrides defaults.
+type Config struct {
+	Path string `json:"-"` // File the config was read from, "" if none
+
+	Provider    string   `json:"provider"`     // Provider to supervise
+	Strategy    string   `json:"strategy"`     // Rotation strategy name
+	Interval    Duration `json:"interval"`     // How often to check limits
+	Threshold   float64  `json:"threshold"`    // Rotate above this fraction
+	ProbeModel  string   `json:"probe_model"`  // Model for probes that need one
+	Grace       Duration `json:"grace"`        // SIGTERM to SIGKILL wait
+	Proxy       bool     `json:"proxy"`        // Run in proxy mode
+	PTY         bool     `json:"pty"`          // Run the command on a pseudo-terminal
+	DiscoverEnv *bool    `json:"discover_env"` // Also scan the environment for tokens (default true)
+	LocalURL    string   `json:"local_url"`    // Local OpenAI-compatible server to fall back to
+	Failover    []string `json:"failover"`     // Providers to move between as each runs out, in order
+
+	ResumeArgs    string   `json:"resume_args"`    // Added to the command on restarts after rotation
+	ResumeCommand []string `json:"resume_command"` // Or the whole command used for them
+	ResumePresets *bool    `json:"resume_presets"` // Use built-in resume commands for known CLIs (default true)
+
+	Hooks     Hooks                    `json:"hooks"`
+	Restart   RestartConfig            `json:"restart"`
+	Commands  map[string]CommandConfig `json:"commands"` // Launch templates by provider name or domain
+	Providers []ProviderConfig         `json:"providers"`
+	Tokens    []TokenSource            `json:"tokens"`
+}
+
+// Hooks are shell commands run when the supervisor rotates, runs out of
+// tokens, or finishes
+type Hooks struct {
+	OnRotate    string `json:"on_rotate"`
+	OnExhausted string `json:"on_exhausted"`
+	OnExit      string `json:"on_exit"`
+}
+
+// RestartConfig says whether and how to restart a command that exits on
+// its own
+type RestartConfig struct {
+	Policy      string   `json:"policy"`       // never, on-failure or always
+	MaxRestarts int      `json:"max_restarts"` // 0 = no limit
+	Backoff     Duration `json:"backoff"`      // First wait, doubling each restart
+	MaxBackoff  Duration `json:"max_backoff"`  // Longest wait
+	CrashLoop   int      `json:"crash_loop"`   // Give up after this many exits...
+	CrashWindow Duration `json:"crash_window"` // ...within this long
+}
+
+// CommandConfig is how to launch the command against one provider. See
+// supervisor.CommandTemplate for the placeholders.
+type CommandConfig struct {
+	Command []string          `json:"command"`
+	Env     map[string]string `json:"env"`
+}
+
+// TokenSource declares where one or more tokens come from. Exactly one of
+// Value, Env and File is set.
+type TokenSource struct {
+	Provider string `json:"provider"` // Provider name or domain
+	Value    string `json:"value"`    // The token itself (prefer env or file)
+	Env      string `json:"env"`      // Env var holding the token
+	File     string `json:"file"`     // File with one token per line
+	Label    string `json:"label"`    // Printable name, instead of where it came from
+	Weight   int    `json:"weight"`   // Share for the weighted strategy
+
+	Endpoint   string `json:"endpoint"`   // API root the token belongs to (Azure)
+	Deployment string `json:"deployment"` // Deployment on that endpoint (Azure)
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in config files
+type Duration time.Duration
+
+// UnmarshalJSON accepts a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Dir returns ddollar's config directory: $XDG_CONFIG_HOME/ddollar,
+// falling back to ~/.config/ddollar
+func Dir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "ddollar")
+	}
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			return filepath.Join(dir, "ddollar")
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "ddollar")
+	}
+	return ""
+}
+
+// SearchPaths returns the files Load tries, in order, when no path is given
+func SearchPaths() []string {
+	paths := []string{FileName}
+	if dir := Dir(); dir != "" {
+		paths = append(paths, filepath.Join(dir, "config.toml"))
+	}
+	return paths
+}
+
+// Load reads the config at path, or the first file found in SearchPaths
+// if path is "". Finding no file is not an error; an explicit path that
+// doesn't exist is. Providers the file declares are returned in Providers
+// for the caller to register.
+func Load(path string) (*Config, error) {
+	if path != "" {
+		return loadFile(path)
+	}
+
+	for _, candidate := range SearchPaths() {
+		cfg, err := loadFile(candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return cfg, err
+	}
+	return &Config{}, nil
+}
+
+// loadFile parses one config file
+func loadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := parseTOML(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// The parsed document has encoding/json's generic shape, so let it do
+	// the typed decoding
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.DisallowUnknownFields()
+
+	cfg := &Config{}
+	if err := decoder.Decode(cfg); err != nil {
+		// Errors name JSON, which the user never wrote
+		msg := strings.TrimPrefix(err.Error(), "json: ")
+		msg = strings.Replace(msg, "unknown field", "unknown key", 1)
+		return nil, fmt.Errorf("%s: %s", path, msg)
+	}
+	cfg.Path = path
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// validate reports the first token source that can't work
+func (c *Config) validate() error {
+	for i, src := range c.Tokens {
+		set := 0
+		for _, s := range []string{src.Value, src.Env, src.File} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("tokens[%d]: set exactly one of value, env or file", i)
+		}
+		if !c.knownProvider(src.Provider) {
+			return fmt.Errorf("tokens[%d]: unknown provider %q", i, src.Provider)
+		}
+		if src.Weight < 0 {
+			return fmt.Errorf("tokens[%d]: weight must not be negative", i)
+		}
+		if p := tokens.GetProviderByName(src.Provider); p != nil && p.EndpointEnv != "" && src.Endpoint == "" && os.Getenv(p.EndpointEnv) == "" {
+			return fmt.Errorf("tokens[%d]: %s tokens need an endpoint", i, p.Name)
+		}
+	}
+	return nil
+}
+
+// knownProvider reports whether name is a built-in provider or one the
+// file declares, by name or domain
+func (c *Config) knownProvider(name string) bool {
+	if tokens.GetProviderByName(name) != nil {
+		return true
+	}
+	for _, pc := range c.Providers {
+		if strings.EqualFold(pc.Name, name) || strings.EqualFold(pc.Domain, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Discover returns the tokens declared in the config merged with those
+// found in the environment (unless discover_env = false), then the local
+// fallback server, if any.
+//
+// Declared tokens come first, in file order. A token found both ways is
+// listed once, where it was declared, keeping the declared label and
+// weight. Providers are ordered by first appearance, declared ones first.
+func (c *Config) Discover() ([]tokens.ProviderTokens, error) {
+	var results []tokens.ProviderTokens
+	index := make(map[string]int) // provider domain -> position in results
+	seen := make(map[string]bool)
+
+	add := func(t tokens.Token) {
+		t.Value = strings.TrimSpace(t.Value)
+		if t.Value == "" || seen[t.Value] {
+			return
+		}
+		seen[t.Value] = true
+
+		i, ok := index[t.Provider.Domain]
+		if !ok {
+			i = len(results)
+			index[t.Provider.Domain] = i
+			results = append(results, tokens.ProviderTokens{Provider: t.Provider})
+		}
+		results[i].Tokens = append(results[i].Tokens, t)
+	}
+
+	for i, src := range c.Tokens {
+		values, sources, err := src.resolve(filepath.Dir(c.Path))
+		if err != nil {
+			return nil, fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+
+		provider := tokens.GetProviderByName(src.Provider)
+		if src.Endpoint == "" && provider.EndpointEnv != "" {
+			src.Endpoint = os.Getenv(provider.EndpointEnv)
+		}
+		if src.Deployment == "" && provider.DeploymentEnv != "" {
+			src.Deployment = os.Getenv(provider.DeploymentEnv)
+		}
+		for j, value := range values {
+			source := sources[j]
+			if src.Label != "" {
+				source = src.Label
+				if len(values) > 1 {
+					source = fmt.Sprintf("%s[%d]", src.Label, j+1)
+				}
+			}
+			add(tokens.Token{
+				Value:      value,
+				Provider:   provider,
+				Source:     source,
+				Weight:     src.Weight,
+				Endpoint:   src.Endpoint,
+				Deployment: src.Deployment,
+			})
+		}
+	}
+
+	if c.DiscoverEnv == nil || *c.DiscoverEnv {
+		for _, pt := range tokens.Discover() {
+			for _, t := range pt.Tokens {
+				add(t)
+			}
+		}
+	}
+
+	// The local fallback always comes last
+	if c.LocalURL != "" {
+		for _, t := range tokens.LocalTokens(c.LocalURL, "local_url").Tokens {
+			add(t)
+		}
+	}
+
+	return results, nil
+}
+
+// resolve reads a source's token values and where each came from.
+// Relative file paths are relative to dir, the config file's directory.
+func (src TokenSource) resolve(dir string) (values, sources []string, err error) {
+	switch {
+	case src.Value != "":
+		return []string{src.Value}, []string{"config"}, nil
+
+	case src.Env != "":
+		value := os.Getenv(src.Env)
+		if value == "" {
+			// An unset variable is skipped like any other missing env token
+			return nil, nil, nil
+		}
+		return []string{value}, []string{src.Env}, nil
+
+	default:
+		path := expandHome(src.File)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			values = append(values, line)
+			sources = append(sources, fmt.Sprintf("%s[%d]", filepath.Base(path), len(values)))
+		}
+		return values, sources, nil
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
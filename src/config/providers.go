@@ -0,0 +1,61 @@
+package config
+
+import "github.com/drawohara/ddollar/src/tokens"
+
+// ProviderConfig declares a provider that isn't built in, such as an
+// internal gateway. Once registered (by main, with a checker built from
+// Probe and Limits) they are discovered, pooled, probed and proxied exactly
+// like built-in ones.
+type ProviderConfig struct {
+	Name        string   `json:"name"`
+	Domain      string   `json:"domain"`
+	EnvVars     []string `json:"env_vars"`
+	AuthHeader  string   `json:"auth_header"` // Default "Authorization" with prefix "Bearer "
+	AuthPrefix  string   `json:"auth_prefix"`
+	BaseURL     string   `json:"base_url"`      // Upstream API root, for proxy mode
+	BaseURLEnv  string   `json:"base_url_env"`  // Env var pointing the command at the proxy
+	BaseURLPath string   `json:"base_url_path"` // Path appended to the proxy URL
+
+	Probe  ProbeConfig  `json:"probe"`
+	Limits LimitsConfig `json:"limits"`
+}
+
+// ProbeConfig is the request sent to read a token's limits
+type ProbeConfig struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Body    string            `json:"body"`
+	Headers map[string]string `json:"headers"`
+	Model   string            `json:"model"`
+}
+
+// LimitsConfig maps response headers to rate limit fields. Format starts
+// from a built-in layout (see supervisor.HeaderMapByName); explicit names
+// override it.
+type LimitsConfig struct {
+	Format            string   `json:"format"`
+	RequestsLimit     string   `json:"requests_limit"`
+	RequestsRemaining string   `json:"requests_remaining"`
+	TokensLimit       string   `json:"tokens_limit"`
+	TokensRemaining   string   `json:"tokens_remaining"`
+	Reset             []string `json:"reset"`
+	ResetFormat       string   `json:"reset_format"` // duration, seconds, unix, unix_ms or rfc3339
+}
+
+// Provider converts the declaration to a tokens.Provider
+func (pc ProviderConfig) Provider() tokens.Provider {
+	p := tokens.Provider{
+		Name:        pc.Name,
+		Domain:      pc.Domain,
+		EnvVars:     pc.EnvVars,
+		AuthHeader:  pc.AuthHeader,
+		AuthPrefix:  pc.AuthPrefix,
+		BaseURL:     pc.BaseURL,
+		BaseURLEnv:  pc.BaseURLEnv,
+		BaseURLPath: pc.BaseURLPath,
+	}
+	if p.AuthHeader == "" && p.AuthPrefix == "" {
+		p.AuthHeader, p.AuthPrefix = "Authorization", "Bearer "
+	}
+	return p
+}
@@ -0,0 +1,430 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML reads the subset of TOML ddollar's config uses: comments,
+// [tables], [[arrays of tables]], dotted table names, and key = value pairs
+// whose values are strings, integers, floats, booleans, arrays or inline
+// tables. The result maps directly onto encoding/json's generic form.
+func parseTOML(data string) (map[string]any, error) {
+	root := make(map[string]any)
+	current := root
+
+	p := &tomlParser{src: data, line: 1, defined: make(map[uintptr]bool)}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			current, err = p.header(root)
+		} else {
+			err = p.keyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+
+		p.skipSpace()
+		p.skipComment()
+		if !p.eof() && p.peek() != '\n' {
+			return nil, fmt.Errorf("line %d: unexpected %q", p.line, p.peek())
+		}
+	}
+}
+
+type tomlParser struct {
+	src     string
+	pos     int
+	line    int
+	defined map[uintptr]bool // tables opened by a [header], by identity
+}
+
+func (p *tomlParser) eof() bool  { return p.pos >= len(p.src) }
+func (p *tomlParser) peek() byte { return p.src[p.pos] }
+
+func (p *tomlParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips spaces and tabs on the current line
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.pos++
+	}
+}
+
+// skipComment skips a # comment up to the end of the line
+func (p *tomlParser) skipComment() {
+	if !p.eof() && p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		p.skipComment()
+		if p.eof() || p.peek() != '\n' {
+			return
+		}
+		p.next()
+	}
+}
+
+// header parses [table] or [[array]] and returns the table it opens
+func (p *tomlParser) header(root map[string]any) (map[string]any, error) {
+	p.next()
+	array := !p.eof() && p.peek() == '['
+	if array {
+		p.next()
+	}
+
+	keys, err := p.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return nil, fmt.Errorf("expected %q", closing)
+	}
+	p.pos += len(closing)
+
+	// Walk to the parent, descending into the last element of arrays of tables
+	table := root
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = descend(table, key); err != nil {
+			return nil, err
+		}
+	}
+
+	last := keys[len(keys)-1]
+	if array {
+		existing, _ := table[last].([]any)
+		if _, ok := table[last]; ok && existing == nil {
+			return nil, fmt.Errorf("%s is not an array of tables", last)
+		}
+		t := make(map[string]any)
+		table[last] = append(existing, t)
+		return t, nil
+	}
+
+	if _, ok := table[last].([]any); ok {
+		return nil, fmt.Errorf("%s is an array of tables, use [[%s]]", last, strings.Join(keys, "."))
+	}
+	t, err := descend(table, last)
+	if err != nil {
+		return nil, err
+	}
+	id := reflect.ValueOf(t).Pointer()
+	if p.defined[id] {
+		return nil, fmt.Errorf("[%s] is defined twice", strings.Join(keys, "."))
+	}
+	p.defined[id] = true
+	return t, nil
+}
+
+// descend returns the table at key, creating it if needed
+func descend(table map[string]any, key string) (map[string]any, error) {
+	switch v := table[key].(type) {
+	case nil:
+		t := make(map[string]any)
+		table[key] = t
+		return t, nil
+	case map[string]any:
+		return v, nil
+	case []any:
+		if len(v) > 0 {
+			if t, ok := v[len(v)-1].(map[string]any); ok {
+				return t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s is not a table", key)
+}
+
+// keyValue parses key = value into table
+func (p *tomlParser) keyValue(table map[string]any) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	if p.eof() || p.next() != '=' {
+		return fmt.Errorf("expected '=' after %s", strings.Join(keys, "."))
+	}
+	p.skipSpace()
+
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		if table, err = descend(table, key); err != nil {
+			return err
+		}
+	}
+	last := keys[len(keys)-1]
+	if _, exists := table[last]; exists {
+		return fmt.Errorf("%s is set twice", last)
+	}
+	table[last] = value
+	return nil
+}
+
+// keys parses a possibly dotted, possibly quoted key
+func (p *tomlParser) keys() ([]string, error) {
+	var keys []string
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, fmt.Errorf("expected key")
+		}
+
+		var key string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected key, got %q", c)
+			}
+			key = p.src[start:p.pos]
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value parses any value
+func (p *tomlParser) value() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected value")
+	}
+
+	switch c := p.peek(); c {
+	case '"', '\'':
+		return p.str()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+
+	if n, ok := parseNumber(word); ok {
+		return n, nil
+	}
+	return nil, fmt.Errorf("invalid value %q (strings need quotes)", word)
+}
+
+// parseNumber parses a TOML integer (decimal, or 0x/0o/0b prefixed) or a
+// decimal float. Leading zeros, inf and nan are rejected: the first is not
+// octal in TOML, and the others can't be represented in JSON.
+func parseNumber(word string) (any, bool) {
+	number := strings.ReplaceAll(word, "_", "")
+
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if digits, ok := strings.CutPrefix(number, prefix); ok {
+			n, err := strconv.ParseInt(digits, base, 64)
+			return n, err == nil && digits != "" && digits[0] != '-' && digits[0] != '+'
+		}
+	}
+
+	unsigned := strings.TrimLeft(number, "+-")
+	if unsigned == "" || len(number)-len(unsigned) > 1 || strings.Trim(unsigned, "0123456789.eE+-") != "" {
+		return nil, false
+	}
+	if whole, _, _ := strings.Cut(strings.ToLower(unsigned), "e"); len(whole) > 1 && whole[0] == '0' && whole[1] != '.' {
+		return nil, false // Leading zero
+	}
+
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, false
+	}
+	return f, true
+}
+
+// str parses a "basic" or 'literal' single-line string
+func (p *tomlParser) str() (string, error) {
+	quote := p.next()
+
+	var b strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.next()
+		switch {
+		case c == quote:
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if p.eof() {
+				return "", fmt.Errorf("unterminated string")
+			}
+			switch e := p.next(); e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				r, err := p.unicodeEscape(e)
+				if err != nil {
+					return "", err
+				}
+				b.WriteRune(r)
+			default:
+				return "", fmt.Errorf("unsupported escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// unicodeEscape parses the hex digits of a \uXXXX or \UXXXXXXXX escape
+func (p *tomlParser) unicodeEscape(kind byte) (rune, error) {
+	size := 4
+	if kind == 'U' {
+		size = 8
+	}
+	if p.pos+size > len(p.src) {
+		return 0, fmt.Errorf("short \\%c escape", kind)
+	}
+
+	digits := p.src[p.pos : p.pos+size]
+	n, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || strings.ContainsAny(digits, "+-_") || !utf8.ValidRune(rune(n)) {
+		return 0, fmt.Errorf("invalid escape \\%c%s", kind, digits)
+	}
+	p.pos += size
+	return rune(n), nil
+}
+
+// array parses [a, b, ...], which may span lines
+func (p *tomlParser) array() ([]any, error) {
+	p.next()
+	values := []any{}
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.next()
+			return values, nil
+		}
+
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		switch p.peek() {
+		case ',':
+			p.next()
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected ',' or ']' in array, got %q", p.peek())
+		}
+	}
+}
+
+// inlineTable parses { key = value, ... } on one line
+func (p *tomlParser) inlineTable() (map[string]any, error) {
+	p.next()
+	table := make(map[string]any)
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() == '\n' {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		if p.peek() == '}' {
+			p.next()
+			return table, nil
+		}
+
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		switch p.peek() {
+		case ',':
+			p.next()
+		case '}':
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in inline table, got %q", p.peek())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string // JSON of the parsed document
+	}{
+		{
+			name: "scalars",
+			src: `
+# comment
+name = "ddollar" # trailing comment
+literal = 'C:\path'
+count = 10
+negative = -3
+big = 1_000
+hex = 0xff
+octal = 0o17
+binary = 0b101
+ratio = 0.95
+exp = 1e3
+zero = 0
+on = true
+off = false
+`,
+			want: `{"big":1000,"binary":5,"count":10,"exp":1000,"hex":255,"literal":"C:\\path","name":"ddollar","negative":-3,"octal":15,"off":false,"on":true,"ratio":0.95,"zero":0}`,
+		},
+		{
+			name: "escapes",
+			src:  `s = "tab\tquote\"slash\\ \u00e9 \U0001F600"`,
+			want: `{"s":"tab\tquote\"slash\\ é 😀"}`,
+		},
+		{
+			name: "arrays span lines and allow a trailing comma",
+			src: `list = [
+  "a", # first
+  "b",
+]
+empty = []
+nested = [[1, 2], [3]]`,
+			want: `{"empty":[],"list":["a","b"],"nested":[[1,2],[3]]}`,
+		},
+		{
+			name: "tables, dotted names and inline tables",
+			src: `[supervisor.resume]
+args = "--continue"
+
+[supervisor]
+interval = "30s"
+
+[commands]
+groq = { command = "aider {token}", env = { KEY = "{token}" } }`,
+			want: `{"commands":{"groq":{"command":"aider {token}","env":{"KEY":"{token}"}}},"supervisor":{"interval":"30s","resume":{"args":"--continue"}}}`,
+		},
+		{
+			name: "arrays of tables",
+			src: `[[providers]]
+name = "a"
+[providers.limits]
+rpm = 1
+
+[[providers]]
+name = "b"
+[providers.limits]
+rpm = 2`,
+			want: `{"providers":[{"limits":{"rpm":1},"name":"a"},{"limits":{"rpm":2},"name":"b"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseTOML(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{"leading zero", "n = 010", `invalid value "010"`},
+		{"negative leading zero", "n = -07", `invalid value "-07"`},
+		{"float leading zero", "n = 00.5", `invalid value "00.5"`},
+		{"inf", "n = inf", `invalid value "inf"`},
+		{"nan", "n = nan", `invalid value "nan"`},
+		{"signed inf", "n = +inf", `invalid value "+inf"`},
+		{"float overflow", "n = 1e999", `invalid value "1e999"`},
+		{"hex float", "n = 0x1p3", `invalid value "0x1p3"`},
+		{"bare string", "s = hello", "strings need quotes"},
+		{"array without commas", `a = ["x" "y"]`, "expected ',' or ']'"},
+		{"multiline array without commas", "a = [\n1\n2\n]", "expected ',' or ']'"},
+		{"unterminated array", "a = [1, 2", "unterminated array"},
+		{"inline table without commas", `t = { a = 1 b = 2 }`, "expected ',' or '}'"},
+		{"duplicate table", "[a]\nx = 1\n[a]\ny = 2", "[a] is defined twice"},
+		{"duplicate dotted table", "[a.b]\n[a]\n[a.b]", "[a.b] is defined twice"},
+		{"table over array of tables", "[[p]]\n[p]", "is an array of tables"},
+		{"duplicate key", "a = 1\na = 2", "a is set twice"},
+		{"short unicode escape", `s = "\u00e"`, `invalid escape`},
+		{"surrogate escape", `s = "\ud800"`, `invalid escape \ud800`},
+		{"unknown escape", `s = "\q"`, `unsupported escape \q`},
+		{"unterminated string", `s = "abc`, "unterminated string"},
+		{"trailing garbage", "a = 1 2", `unexpected '2'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.src)
+			if err == nil {
+				t.Fatalf("parsed %q, want error containing %q", tt.src, tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %q, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseTOMLReportsLine(t *testing.T) {
+	_, err := parseTOML("a = 1\n\n[b]\nc = 010\n")
+	if err == nil || !strings.HasPrefix(err.Error(), "line 4:") {
+		t.Errorf("got %v, want an error on line 4", err)
+	}
+}
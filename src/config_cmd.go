@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/drawohara/ddollar/src/config"
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// configCommand runs `ddollar config show [flags]`, printing the settings
+// a supervised run with the same flags would use
+func configCommand(args []string) {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Println("Usage: ddollar config show [flags]")
+		os.Exit(1)
+	}
+
+	cli, err := parseFlags(args[1:])
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	discovered, err := cli.config.Discover()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := cli.supervisor
+	if cli.config.Path != "" {
+		fmt.Printf("# Effective config: flags > %s > defaults\n", cli.config.Path)
+	} else {
+		fmt.Printf("# Effective config: flags > defaults (no config file in %s)\n", strings.Join(config.SearchPaths(), ", "))
+	}
+	fmt.Println("# Token values are masked")
+	fmt.Println()
+
+	provider := cli.provider
+	if provider == "" && len(cli.failover) > 0 {
+		provider = cli.failover[0]
+	}
+	if provider == "" && len(discovered) > 0 {
+		provider = discovered[0].Provider.Name
+	}
+	printSetting("provider", strconv.Quote(provider))
+	printSetting("strategy", strconv.Quote(cli.strategy.Name()))
+	printSetting("interval", strconv.Quote(opts.Interval.String()))
+	printSetting("threshold", strconv.FormatFloat(opts.Threshold, 'g', -1, 64))
+	printSetting("probe_model", strconv.Quote(opts.ProbeModel))
+	printSetting("grace", strconv.Quote(opts.Grace.String()))
+	printSetting("proxy", strconv.FormatBool(opts.Proxy))
+	printSetting("pty", strconv.FormatBool(opts.PTY))
+	printSetting("state", strconv.Quote(cli.statePath))
+	printSetting("lease", strconv.FormatBool(cli.lease))
+	printSetting("failover", quoteList(cli.failover))
+	printSetting("resume_command", quoteList(opts.ResumeFor(cli.command)))
+
+	fmt.Println("\n[restart]")
+	printSetting("policy", strconv.Quote(opts.Restart.Policy))
+	printSetting("max_restarts", strconv.Itoa(opts.Restart.MaxRestarts))
+	printSetting("backoff", strconv.Quote(opts.Restart.Backoff.String()))
+	printSetting("max_backoff", strconv.Quote(opts.Restart.MaxBackoff.String()))
+	printSetting("crash_loop", strconv.Itoa(opts.Restart.CrashLoop))
+	printSetting("crash_window", strconv.Quote(opts.Restart.CrashWindow.String()))
+
+	fmt.Println("\n[hooks]")
+	printSetting("on_rotate", strconv.Quote(opts.Hooks.OnRotate))
+	printSetting("on_exhausted", strconv.Quote(opts.Hooks.OnExhausted))
+	printSetting("on_exit", strconv.Quote(opts.Hooks.OnExit))
+
+	names := make([]string, 0, len(opts.Commands))
+	for name := range opts.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl := opts.Commands[name]
+		fmt.Printf("\n[commands.%s]\n", name)
+		printSetting("command", quoteList(tmpl.Command))
+		envNames := make([]string, 0, len(tmpl.Env))
+		for envName := range tmpl.Env {
+			envNames = append(envNames, envName)
+		}
+		sort.Strings(envNames)
+		pairs := make([]string, len(envNames))
+		for i, envName := range envNames {
+			pairs[i] = envName + " = " + strconv.Quote(tmpl.Env[envName])
+		}
+		env := "{}"
+		if len(pairs) > 0 {
+			env = "{ " + strings.Join(pairs, ", ") + " }"
+		}
+		printSetting("env", env)
+	}
+
+	for _, pt := range discovered {
+		for _, t := range pt.Tokens {
+			fmt.Println("\n[[tokens]]")
+			printSetting("provider", strconv.Quote(t.Provider.Name))
+			printSetting("label", strconv.Quote(t.Label()))
+			printSetting("value", strconv.Quote(tokens.MaskToken(t.Value)))
+			printSetting("weight", strconv.Itoa(max(t.Weight, 1)))
+			if t.Endpoint != "" {
+				printSetting("endpoint", strconv.Quote(t.Endpoint))
+			}
+			if t.Deployment != "" {
+				printSetting("deployment", strconv.Quote(t.Deployment))
+			}
+		}
+	}
+}
+
+// quoteList formats a list of strings as a TOML array
+func quoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// printSetting prints one key = value line
+func printSetting(key, value string) {
+	fmt.Printf("%-14s = %s\n", key, value)
+}
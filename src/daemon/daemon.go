@@ -0,0 +1,506 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drawohara/ddollar/src/supervisor"
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// Options configures a Daemon
+type Options struct {
+	Socket    string        // Unix socket to listen on
+	Probe     bool          // Watch leased tokens with the monitor
+	Interval  time.Duration // Monitor interval
+	Threshold float64       // Usage fraction at which a token is cooled down
+}
+
+// Daemon owns the machine's token pool and hands out leases over a
+// JSON-over-Unix-socket API, one request and one reply per line. Leases
+// are bound to the connection that made them unless a TTL is given, so a
+// supervisor that dies gives its token back.
+type Daemon struct {
+	pool    *tokens.Pool
+	monitor *supervisor.Monitor
+	opts    Options
+
+	mu     sync.Mutex
+	leases map[string]*lease // lease ID -> lease
+	nextID int
+}
+
+// lease is one borrowed token
+type lease struct {
+	id      string
+	tokenID string
+	token   *tokens.Token      // nil when coordinating a token the daemon doesn't hold
+	owner   net.Conn           // connection the lease dies with, nil for TTL leases
+	ttl     time.Duration      // zero for connection-bound leases
+	expires time.Time          // zero for connection-bound leases
+	stop    context.CancelFunc // stops the lease's monitor, if probing
+}
+
+// New creates a daemon around pool
+func New(pool *tokens.Pool, opts Options) *Daemon {
+	monitor := supervisor.NewMonitor(opts.Interval, opts.Threshold)
+	monitor.SetPool(pool)
+
+	return &Daemon{
+		pool:    pool,
+		monitor: monitor,
+		opts:    opts,
+		leases:  make(map[string]*lease),
+	}
+}
+
+// Serve listens on the socket until ctx is cancelled
+func (d *Daemon) Serve(ctx context.Context) error {
+	if err := os.MkdirAll(filepath.Dir(d.opts.Socket), 0o700); err != nil {
+		return err
+	}
+
+	// A socket left by a daemon that died is removed; a live one is an error
+	if conn, err := net.Dial("unix", d.opts.Socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", d.opts.Socket)
+	}
+	os.Remove(d.opts.Socket)
+
+	listener, err := listenPrivate(d.opts.Socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(d.opts.Socket)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	go d.expireLeases(ctx)
+
+	log.Printf("Daemon: listening on %s", d.opts.Socket)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				d.releaseAll()
+				return d.pool.SaveState()
+			}
+			return err
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle serves one connection, releasing its leases when it closes
+func (d *Daemon) handle(conn net.Conn) {
+	defer conn.Close()
+	defer d.releaseOwnedBy(conn)
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req tokens.BrokerRequest
+		var resp *tokens.BrokerResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp = failure(fmt.Errorf("invalid request: %w", err))
+		} else {
+			resp = d.dispatch(req, conn)
+		}
+
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// dispatch runs one request
+func (d *Daemon) dispatch(req tokens.BrokerRequest, conn net.Conn) *tokens.BrokerResponse {
+	switch req.Op {
+	case tokens.OpLease:
+		return d.lease(req, conn)
+	case tokens.OpRelease:
+		return d.release(req)
+	case tokens.OpReportStatus:
+		return d.reportStatus(req)
+	case tokens.OpList:
+		return d.list()
+	case tokens.OpRotate:
+		return d.rotate(req, conn)
+	default:
+		return failure(fmt.Errorf("unknown op %q", req.Op))
+	}
+}
+
+// lease grants a specific token, or the best free token of a provider
+func (d *Daemon) lease(req tokens.BrokerRequest, conn net.Conn) *tokens.BrokerResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := req.TokenID
+	if id != "" {
+		if d.leasedLocked(id) {
+			return failure(errors.New(tokens.ErrLeased))
+		}
+	} else {
+		token, err := d.chooseLocked(req.Provider)
+		if err != nil {
+			return failure(err)
+		}
+		id = tokens.TokenID(token.Value)
+	}
+
+	// Tokens the daemon doesn't hold can still be coordinated by ID
+	l := d.grantLocked(id, time.Duration(req.TTL)*time.Second, conn)
+	return &tokens.BrokerResponse{OK: true, Lease: l.info()}
+}
+
+// release ends a lease
+func (d *Daemon) release(req tokens.BrokerRequest) *tokens.BrokerResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	l := d.leases[req.LeaseID]
+	if l == nil {
+		return failure(fmt.Errorf("unknown lease %q", req.LeaseID))
+	}
+	d.endLocked(l)
+	return &tokens.BrokerResponse{OK: true}
+}
+
+// reportStatus records limits for a token, parsing raw headers if given
+func (d *Daemon) reportStatus(req tokens.BrokerRequest) *tokens.BrokerResponse {
+	id := req.TokenID
+	if id == "" {
+		d.mu.Lock()
+		if l := d.leases[req.LeaseID]; l != nil {
+			id = l.tokenID
+		}
+		d.mu.Unlock()
+	}
+
+	token := d.tokenByID(id)
+	if token == nil {
+		return failure(errors.New(tokens.ErrUnknownToken))
+	}
+
+	status, err := statusFrom(token, req)
+	if err != nil {
+		return failure(err)
+	}
+	if status == nil {
+		return failure(errors.New("report-status needs status, headers or http_status"))
+	}
+
+	d.recordStatus(token, status)
+	return &tokens.BrokerResponse{OK: true}
+}
+
+// list describes every token the daemon holds
+func (d *Daemon) list() *tokens.BrokerResponse {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	resp := &tokens.BrokerResponse{OK: true}
+	for _, domain := range d.pool.Domains() {
+		for _, t := range d.pool.Tokens(domain) {
+			if t.Provider.Local {
+				continue
+			}
+			id := tokens.TokenID(t.Value)
+			resp.Tokens = append(resp.Tokens, tokens.TokenInfo{
+				TokenID:      id,
+				Label:        t.Label(),
+				Provider:     t.Provider.Name,
+				Leased:       d.leasedLocked(id),
+				CoolingUntil: d.pool.CoolingUntil(t.Value),
+				Status:       d.pool.Status(t.Value),
+				Usage:        d.pool.Ledger().Get(t.Value),
+			})
+		}
+	}
+	return resp
+}
+
+// rotate ends a lease, cooling its token if a status says so, and leases
+// the provider's next free token on the same terms
+func (d *Daemon) rotate(req tokens.BrokerRequest, conn net.Conn) *tokens.BrokerResponse {
+	d.mu.Lock()
+	l := d.leases[req.LeaseID]
+	d.mu.Unlock()
+	if l == nil {
+		return failure(fmt.Errorf("unknown lease %q", req.LeaseID))
+	}
+	if l.token == nil {
+		return failure(errors.New("cannot rotate a token the daemon doesn't hold"))
+	}
+
+	// The status is about the token, so it counts even if the lease ends
+	// meanwhile
+	status, err := statusFrom(l.token, req)
+	if err != nil {
+		return failure(err)
+	}
+	if status != nil {
+		d.recordStatus(l.token, status)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// A concurrent release may have ended the lease while the lock was
+	// dropped; only rotate one that is still held
+	if d.leases[req.LeaseID] != l {
+		return failure(fmt.Errorf("unknown lease %q", req.LeaseID))
+	}
+	d.endLocked(l)
+	next, err := d.chooseLocked(l.token.Provider.Name)
+	if err != nil {
+		return failure(err)
+	}
+
+	ttl := l.ttl
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	granted := d.grantLocked(tokens.TokenID(next.Value), ttl, conn)
+	return &tokens.BrokerResponse{OK: true, Lease: granted.info()}
+}
+
+// recordStatus feeds a status into the pool, cooling the token down if it
+// is past the threshold. Only a new cooldown is saved right away; the rest
+// is saved when the daemon stops.
+func (d *Daemon) recordStatus(token *tokens.Token, status *tokens.RateLimitStatus) {
+	before := d.pool.CoolingUntil(token.Value)
+	d.pool.RecordStatus(token.Value, status)
+
+	if status.ShouldRotate(d.opts.Threshold) {
+		resetAt := status.ResetTime
+		if !resetAt.After(time.Now()) {
+			resetAt = time.Now().Add(time.Minute)
+		}
+		d.pool.CoolDown(token.Value, resetAt)
+	}
+
+	until := d.pool.CoolingUntil(token.Value)
+	if !until.After(before) {
+		return
+	}
+	log.Printf("Daemon: %s cooling down until %s", token.Label(), until.Format(time.TimeOnly))
+
+	if err := d.pool.SaveState(); err != nil {
+		log.Printf("Daemon: failed to save state: %v", err)
+	}
+}
+
+// chooseLocked picks the best unleased, non-cooling token for a provider
+func (d *Daemon) chooseLocked(provider string) (*tokens.Token, error) {
+	domain := d.pool.Lookup(provider)
+	if active := d.pool.Active(); provider == "" && active != nil {
+		domain = active.Domain
+	}
+	if domain == "" {
+		return nil, fmt.Errorf("no tokens for provider %q", provider)
+	}
+	if held := d.pool.Tokens(domain); len(held) > 0 && held[0].Provider.Local {
+		return nil, errors.New("a local server has no tokens to lease")
+	}
+
+	var free []tokens.Candidate
+	for _, c := range d.pool.Candidates(domain) {
+		if !d.leasedLocked(tokens.TokenID(c.Token.Value)) {
+			free = append(free, c)
+		}
+	}
+	if len(free) == 0 {
+		if reset := d.pool.EarliestReset(domain); !reset.IsZero() {
+			return nil, fmt.Errorf("no free token (next reset at %s)", reset.Format(time.RFC3339))
+		}
+		return nil, errors.New("no free token")
+	}
+
+	return free[d.pool.Strategy().Choose(free)].Token, nil
+}
+
+// grantLocked records a new lease and starts watching its token
+func (d *Daemon) grantLocked(id string, ttl time.Duration, conn net.Conn) *lease {
+	d.nextID++
+	l := &lease{
+		id:      strconv.Itoa(d.nextID),
+		tokenID: id,
+		token:   d.tokenByID(id),
+		owner:   conn,
+	}
+	if ttl > 0 {
+		l.owner = nil
+		l.ttl = ttl
+		l.expires = time.Now().Add(ttl)
+	}
+	d.leases[l.id] = l
+
+	if d.opts.Probe && l.token != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		l.stop = cancel
+		go d.watch(ctx, l.token)
+	}
+
+	return l
+}
+
+// watch probes a leased token and cools it down when it nears its limit
+func (d *Daemon) watch(ctx context.Context, token *tokens.Token) {
+	statusChan := make(chan *tokens.RateLimitStatus)
+	go d.monitor.Watch(ctx, token, statusChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-statusChan:
+			d.recordStatus(token, status)
+		}
+	}
+}
+
+// endLocked removes a lease and stops its monitor
+func (d *Daemon) endLocked(l *lease) {
+	if l.stop != nil {
+		l.stop()
+	}
+	delete(d.leases, l.id)
+}
+
+// releaseOwnedBy ends every lease bound to conn
+func (d *Daemon) releaseOwnedBy(conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, l := range d.leases {
+		if l.owner == conn {
+			d.endLocked(l)
+		}
+	}
+}
+
+// releaseAll ends every lease
+func (d *Daemon) releaseAll() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, l := range d.leases {
+		d.endLocked(l)
+	}
+}
+
+// expireLeases ends TTL leases once they run out
+func (d *Daemon) expireLeases(ctx context.Context) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.mu.Lock()
+			for _, l := range d.leases {
+				if !l.expires.IsZero() && now.After(l.expires) {
+					d.endLocked(l)
+				}
+			}
+			d.mu.Unlock()
+		}
+	}
+}
+
+// leasedLocked reports whether any lease holds the token
+func (d *Daemon) leasedLocked(id string) bool {
+	for _, l := range d.leases {
+		if l.tokenID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenByID finds a token the daemon holds. A local server's URL is not one.
+func (d *Daemon) tokenByID(id string) *tokens.Token {
+	for _, domain := range d.pool.Domains() {
+		for _, t := range d.pool.Tokens(domain) {
+			if !t.Provider.Local && tokens.TokenID(t.Value) == id {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// info describes a lease for a reply, including the token itself so
+// scripts can use it
+func (l *lease) info() *tokens.LeaseInfo {
+	info := &tokens.LeaseInfo{
+		ID:      l.id,
+		TokenID: l.tokenID,
+		Expires: l.expires,
+	}
+	if l.token != nil {
+		info.Token = l.token.Value
+		info.Label = l.token.Label()
+		info.Provider = l.token.Provider.Name
+		info.Endpoint = l.token.Endpoint
+		info.Deployment = l.token.Deployment
+	}
+	return info
+}
+
+// statusFrom takes a request's status as given, or parses it from the
+// reported response. Returns nil if the request carries neither.
+func statusFrom(token *tokens.Token, req tokens.BrokerRequest) (*tokens.RateLimitStatus, error) {
+	if req.Headers == nil && req.Code == 0 {
+		return req.Status, nil
+	}
+	return parseHeaders(token.Provider, req.Code, req.Headers)
+}
+
+// parseHeaders turns raw response headers into a status with the provider's checker
+func parseHeaders(provider *tokens.Provider, code int, headers map[string]string) (*tokens.RateLimitStatus, error) {
+	checker := supervisor.CheckerFor(provider)
+	if checker == nil {
+		return nil, fmt.Errorf("no limit checker for provider: %s", provider.Name)
+	}
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	resp := &http.Response{StatusCode: code, Header: make(http.Header)}
+	for name, value := range headers {
+		resp.Header.Set(name, value)
+	}
+
+	status, err := checker.ParseStatus(resp)
+	if err != nil {
+		return nil, err
+	}
+	status.Provider = provider.Name
+	return status, nil
+}
+
+// failure builds an error reply
+func failure(err error) *tokens.BrokerResponse {
+	return &tokens.BrokerResponse{Error: err.Error()}
+}
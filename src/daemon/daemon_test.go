@@ -0,0 +1,132 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+var testProvider = &tokens.Provider{Name: "Test", Domain: "test.example", EnvVars: []string{"TEST_KEY"}}
+
+// startDaemon serves a daemon holding keys on a socket in a temp dir
+func startDaemon(t *testing.T, keys ...string) string {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(testProvider, keys); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "broker.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(pool, Options{Socket: socket, Threshold: 0.9}).Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, err := os.Stat(socket); err == nil {
+			return socket
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("daemon did not start listening")
+		}
+	}
+}
+
+func TestSocketIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no Unix permissions")
+	}
+	socket := startDaemon(t, "key-0")
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("socket mode %o, want no group or other access", perm)
+	}
+}
+
+func TestSupervisorsHonorDaemonCooldowns(t *testing.T) {
+	socket := startDaemon(t, "key-0", "key-1", "key-2")
+
+	// Another process reports key-1 exhausted
+	reporter, err := tokens.DialBroker(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reporter.Close()
+	_, err = reporter.Call(tokens.BrokerRequest{
+		Op:      tokens.OpReportStatus,
+		TokenID: tokens.TokenID("key-1"),
+		Status: &tokens.RateLimitStatus{
+			RequestsLimit:     100,
+			RequestsRemaining: 0,
+			ResetTime:         time.Now().Add(time.Hour),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A supervisor's pool rotating away from key-0 skips it
+	client, err := tokens.DialBroker(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(testProvider, []string{"key-0", "key-1", "key-2"}); err != nil {
+		t.Fatal(err)
+	}
+	pool.SetLeaser(client)
+	if !pool.LeaseActive() {
+		t.Fatal("could not lease key-0")
+	}
+
+	if next := pool.Next(); next == nil || next.Value != "key-2" {
+		t.Errorf("rotated to %v, want key-2 (key-1 is cooling down at the daemon)", next)
+	}
+}
+
+func TestUnknownTokenReportsAreQuiet(t *testing.T) {
+	socket := startDaemon(t, "key-0")
+	client, err := tokens.DialBroker(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A key the daemon doesn't hold, coordinated by ID only
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(testProvider, []string{"other-key"}); err != nil {
+		t.Fatal(err)
+	}
+	pool.SetLeaser(client)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	for i := 0; i < 5; i++ {
+		pool.RecordStatus("other-key", &tokens.RateLimitStatus{RequestsLimit: 100, RequestsRemaining: 90 - i})
+		pool.ReleaseLeases() // Waits for the report
+	}
+	log.SetOutput(io.Discard)
+	if logged.Len() > 0 {
+		t.Errorf("reporting an unknown token logged:\n%s", logged.String())
+	}
+}
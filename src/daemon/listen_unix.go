@@ -0,0 +1,23 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"net"
+	"os"
+)
+
+// listenPrivate listens on a Unix socket that only the owner can connect
+// to. The mode is narrowed before the first Accept, without touching the
+// process umask. A directory Serve creates for it is private too.
+func listenPrivate(path string) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
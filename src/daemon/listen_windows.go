@@ -0,0 +1,12 @@
+//go:build windows
+
+package daemon
+
+import "net"
+
+// listenPrivate listens on a Unix socket. Windows has no umask; the socket
+// inherits the ACL of its directory, which by default is in the user's
+// local app data.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/drawohara/ddollar/src/daemon"
+	"github.com/drawohara/ddollar/src/supervisor"
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// daemonCommand runs `ddollar daemon`: one process owning the machine's
+// tokens and handing out leases over a Unix socket
+func daemonCommand(args []string) {
+	defaults := supervisor.DefaultOptions()
+	opts := daemon.Options{
+		Socket:    tokens.DefaultBrokerSocket(),
+		Probe:     true,
+		Interval:  defaults.Interval,
+		Threshold: defaults.Threshold,
+	}
+
+	fs := flag.NewFlagSet("ddollar daemon", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.Socket, "socket", opts.Socket, "Unix socket to listen on")
+	fs.DurationVar(&opts.Interval, "interval", opts.Interval, "how often to probe leased tokens")
+	fs.Float64Var(&opts.Threshold, "threshold", opts.Threshold, "cool a token down above this usage")
+	noProbe := fs.Bool("no-probe", false, "rely on reported statuses only")
+	strategy := fs.String("strategy", tokens.DefaultStrategy, "how to pick a token to lease")
+	statePath := fs.String("state", tokens.DefaultStatePath(), "pool state file")
+	noState := fs.Bool("no-state", false, "don't load or save pool state")
+
+	configPath := fs.String("config", "", "config file")
+
+	if err := fs.Parse(args); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	opts.Probe = !*noProbe
+
+	cfg, unset, err := loadConfig(fs, *configPath)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if unset("interval") && cfg.Interval != 0 {
+		opts.Interval = time.Duration(cfg.Interval)
+	}
+	if unset("threshold") && cfg.Threshold != 0 {
+		opts.Threshold = cfg.Threshold
+	}
+	if unset("strategy") && cfg.Strategy != "" {
+		*strategy = cfg.Strategy
+	}
+
+	check := supervisor.DefaultOptions()
+	check.Interval, check.Threshold = opts.Interval, opts.Threshold
+	if err := check.Validate(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	pool := discoverPool(cfg)
+
+	s, err := tokens.StrategyByName(*strategy)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	pool.SetStrategy(s)
+
+	if !*noState {
+		if err := pool.LoadState(*statePath); err != nil {
+			fmt.Printf("Warning: Not using pool state: %v\n", err)
+		}
+	}
+
+	log.SetFlags(log.Ltime)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := daemon.New(pool, opts).Serve(ctx); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/drawohara/ddollar/src/config"
+	"github.com/drawohara/ddollar/src/supervisor"
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// cliOptions holds everything parsed from ddollar's own flags
+type cliOptions struct {
+	supervisor   supervisor.Options
+	provider     string
+	strategy     tokens.Strategy
+	statePath    string   // "" when persistence is disabled
+	lease        bool     // coordinate tokens with other ddollar processes
+	brokerSocket string   // daemon socket, used for leasing when a daemon is running
+	failover     []string // providers to move between as each runs out, in order
+	config       *config.Config
+	command      []string
+}
+
+// parseFlags parses ddollar flags up to the first non-flag argument;
+// everything from there on is the command to supervise. Settings not given
+// as flags come from the config file, then from defaults.
+func parseFlags(args []string) (*cliOptions, error) {
+	cli := &cliOptions{supervisor: supervisor.DefaultOptions()}
+	opts := &cli.supervisor
+
+	fs := flag.NewFlagSet("ddollar", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	fs.BoolVar(&opts.Interactive, "interactive", false, "prompt user when limit hit")
+	fs.BoolVar(&opts.Interactive, "i", false, "prompt user when limit hit")
+	fs.StringVar(&cli.provider, "provider", "", "provider to supervise")
+	fs.StringVar(&cli.provider, "p", "", "provider to supervise")
+	strategy := fs.String("strategy", tokens.DefaultStrategy, "how to pick the next token")
+	fs.StringVar(&cli.statePath, "state", tokens.DefaultStatePath(), "pool state file")
+	noState := fs.Bool("no-state", false, "don't load or save pool state")
+	noLease := fs.Bool("no-lease", false, "don't coordinate tokens with other ddollar processes")
+	fs.StringVar(&cli.brokerSocket, "broker", tokens.DefaultBrokerSocket(), "daemon socket to lease through")
+	fs.DurationVar(&opts.Interval, "interval", opts.Interval, "how often to check rate limits")
+	fs.Float64Var(&opts.Threshold, "threshold", opts.Threshold, "rotate when usage exceeds this fraction")
+	fs.StringVar(&opts.ProbeModel, "probe-model", opts.ProbeModel, "model used for rate limit probes")
+	fs.DurationVar(&opts.Grace, "grace", opts.Grace, "wait this long after SIGTERM before killing")
+	fs.BoolVar(&opts.Proxy, "proxy", opts.Proxy, "watch limits through a local proxy instead of probing")
+	fs.BoolVar(&opts.PTY, "pty", opts.PTY, "run the command on a pseudo-terminal")
+	fs.StringVar(&opts.Restart.Policy, "restart", opts.Restart.Policy, "restart the command when it exits: never, on-failure, always")
+	fs.IntVar(&opts.Restart.MaxRestarts, "max-restarts", opts.Restart.MaxRestarts, "give up after this many restarts")
+	fs.DurationVar(&opts.Restart.Backoff, "backoff", opts.Restart.Backoff, "wait before the first restart, doubling each time")
+	fs.DurationVar(&opts.Restart.MaxBackoff, "max-backoff", opts.Restart.MaxBackoff, "longest wait between restarts")
+	fs.IntVar(&opts.Restart.CrashLoop, "crash-loop", opts.Restart.CrashLoop, "give up after this many exits within --crash-window")
+	fs.DurationVar(&opts.Restart.CrashWindow, "crash-window", opts.Restart.CrashWindow, "window for --crash-loop")
+	failover := fs.String("failover", "", "comma-separated providers to fail over between")
+	resumeArgs := fs.String("resume-args", "", "arguments added to the command on restarts after rotation")
+	noResume := fs.Bool("no-resume", false, "restart with the original command after rotation")
+	configPath := fs.String("config", "", "config file")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, unset, err := loadConfig(fs, *configPath)
+	if err != nil {
+		return nil, err
+	}
+	cli.config = cfg
+	if unset("provider", "p") && cfg.Provider != "" {
+		cli.provider = cfg.Provider
+	}
+	if unset("strategy") && cfg.Strategy != "" {
+		*strategy = cfg.Strategy
+	}
+	if unset("interval") && cfg.Interval != 0 {
+		opts.Interval = time.Duration(cfg.Interval)
+	}
+	if unset("threshold") && cfg.Threshold != 0 {
+		opts.Threshold = cfg.Threshold
+	}
+	if unset("probe-model") && cfg.ProbeModel != "" {
+		opts.ProbeModel = cfg.ProbeModel
+	}
+	if unset("grace") && cfg.Grace != 0 {
+		opts.Grace = time.Duration(cfg.Grace)
+	}
+	if unset("proxy") && cfg.Proxy {
+		opts.Proxy = true
+	}
+	if unset("pty") && cfg.PTY {
+		opts.PTY = true
+	}
+	applyRestartConfig(&opts.Restart, cfg.Restart, unset)
+	if unset("failover") {
+		cli.failover = cfg.Failover
+	} else {
+		cli.failover = splitList(*failover)
+	}
+	opts.Hooks = supervisor.Hooks(cfg.Hooks)
+	if len(cfg.Commands) > 0 {
+		opts.Commands = make(supervisor.Commands, len(cfg.Commands))
+		for name, cc := range cfg.Commands {
+			opts.Commands[name] = supervisor.CommandTemplate(cc)
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if *noState {
+		cli.statePath = ""
+	}
+	cli.lease = !*noLease
+
+	if cli.strategy, err = tokens.StrategyByName(*strategy); err != nil {
+		return nil, err
+	}
+
+	cli.command = fs.Args()
+
+	// Restarts after rotation resume the session: --resume-args, then the
+	// config file, then a preset for the program
+	switch {
+	case *noResume:
+	case !unset("resume-args"):
+		opts.Resume = supervisor.ResumeArgs(*resumeArgs)
+	case cfg.ResumeCommand != nil:
+		opts.Resume = cfg.ResumeCommand
+	case cfg.ResumeArgs != "":
+		opts.Resume = supervisor.ResumeArgs(cfg.ResumeArgs)
+	case cfg.ResumePresets == nil || *cfg.ResumePresets:
+		opts.ResumePresets = true
+	}
+	return cli, nil
+}
+
+// applyRestartConfig fills in restart settings from the config file's
+// [restart] section where no flag was given
+func applyRestartConfig(policy *supervisor.RestartPolicy, rc config.RestartConfig, unset func(names ...string) bool) {
+	if unset("restart") && rc.Policy != "" {
+		policy.Policy = rc.Policy
+	}
+	if unset("max-restarts") && rc.MaxRestarts != 0 {
+		policy.MaxRestarts = rc.MaxRestarts
+	}
+	if unset("backoff") && rc.Backoff != 0 {
+		policy.Backoff = time.Duration(rc.Backoff)
+	}
+	if unset("max-backoff") && rc.MaxBackoff != 0 {
+		policy.MaxBackoff = time.Duration(rc.MaxBackoff)
+	}
+	if unset("crash-loop") && rc.CrashLoop != 0 {
+		policy.CrashLoop = rc.CrashLoop
+	}
+	if unset("crash-window") && rc.CrashWindow != 0 {
+		policy.CrashWindow = time.Duration(rc.CrashWindow)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadConfig loads the config file, registers the providers it declares,
+// and returns a func reporting whether none of the named flags were given,
+// i.e. whether the file's value applies
+func loadConfig(fs *flag.FlagSet, path string) (*config.Config, func(names ...string) bool, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := registerProviders(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	unset := func(names ...string) bool {
+		for _, name := range names {
+			if set[name] {
+				return false
+			}
+		}
+		return true
+	}
+	return cfg, unset, nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/drawohara/ddollar/src/config"
 	"github.com/drawohara/ddollar/src/supervisor"
 	"github.com/drawohara/ddollar/src/tokens"
 )
@@ -21,6 +24,10 @@ func main() {
 		fmt.Printf("ddollar %s\n", version)
 	case "help", "--help", "-h":
 		printUsage()
+	case "daemon":
+		daemonCommand(os.Args[2:])
+	case "config":
+		configCommand(os.Args[2:])
 	default:
 		// Everything else is a command to supervise
 		superviseCommand(os.Args[1:])
@@ -31,34 +38,84 @@ func printUsage() {
 	fmt.Println(`ddollar - Never hit token limits again
 
 Usage:
-  ddollar [--interactive] <command> [args...]
+  ddollar [flags] <command> [args...]
+  ddollar daemon [--socket PATH] [--no-probe]
+  ddollar config show [flags]            # Print the effective config
 
 Examples:
-  ddollar claude --continue              # All-night AI sessions
+  ddollar claude                         # All-night AI sessions
   ddollar python train_model.py          # Long-running scripts
   ddollar --interactive node agent.js    # Prompt on limit hit
+  ddollar --provider openai aider        # Supervise OpenAI tokens
+  ddollar --interval 30s --threshold 0.9 claude
+  ddollar --resume-args "--resume last" my-agent
+  ddollar --failover anthropic,openai llm-agent
+  ddollar --pty -i claude                # Full-screen TUI with prompts
 
 Flags:
+  --config PATH        Config file (default: ./ddollar.toml, then
+                       $XDG_CONFIG_HOME/ddollar/config.toml)
   --interactive, -i    Prompt user when limit hit (default: auto-rotate)
+  --provider, -p NAME  Provider to supervise (default: first with tokens)
+  --strategy NAME      How to pick the next token: round-robin (default),
+                       lru, headroom, weighted, random, sticky
+  --state PATH         Pool state file (default: $XDG_STATE_HOME/ddollar/state.json)
+  --no-state           Start fresh and don't save pool state
+  --no-lease           Don't coordinate tokens with other ddollar processes
+  --broker PATH        Daemon socket to lease through, if running
+                       (default: $XDG_RUNTIME_DIR/ddollar/broker.sock)
+  --interval DURATION  How often to check rate limits (default: 60s)
+  --threshold FRACTION Rotate when usage exceeds this (default: 0.95)
+  --probe-model MODEL  Model used for Anthropic limit probes
+  --grace DURATION     Wait after SIGTERM before killing (default: 10s)
+  --proxy              Route the command through a local proxy that reads
+                       limits from its traffic and hot-swaps tokens
+                       without restarting (Anthropic, OpenAI)
+  --pty                Run the command on a pseudo-terminal ddollar relays,
+                       so full-screen TUIs survive restarts and prompts
+                       don't fight them for input (Linux, macOS)
+  --restart POLICY     Restart the command when it exits on its own:
+                       never (default), on-failure, always
+  --max-restarts N     Give up after N restarts (default: no limit)
+  --backoff DURATION   Wait before the first restart, doubling each time,
+                       with jitter (default: 1s)
+  --max-backoff DURATION
+                       Longest wait between restarts (default: 5m)
+  --crash-loop N       Give up if the command exits N times within
+  --crash-window DURATION
+                       this long (default: 5 in 1m)
+  --resume-args ARGS   Arguments added to the command when it's restarted
+                       after a rotation (e.g. "--continue"). Built in for
+                       claude, aider, codex and goose
+  --no-resume          Restart with the command exactly as given
+  --failover LIST      Comma-separated providers to move between as each
+                       runs out of tokens (e.g. anthropic,openai)
   --help, -h           Show this help
   --version, -v        Show version
 
+Environment:
+  DDOLLAR_LOCAL_URL    Local OpenAI-compatible server (e.g. Ollama at
+                       http://localhost:11434/v1) to use while every token
+                       is exhausted
+
 How it works:
-  1. Monitors rate limits every 60s
-  2. When >95% used → SIGTERM → rotate token → restart
-  3. Your command's --continue flag picks up where it left off
+  1. Monitors rate limits every --interval
+  2. When usage > --threshold → SIGTERM → rotate token → restart
+  3. The restart adds --continue (or --resume-args), so your command
+     picks up where it left off
 
-Supports: Anthropic · OpenAI · Cohere · Google AI`)
+Supports: Anthropic · OpenAI · Cohere · Google AI · Azure OpenAI · Mistral ·
+          Groq · Together · DeepSeek · xAI · OpenRouter`)
 }
 
 func superviseCommand(args []string) {
-	interactive := false
-
-	// Check for --interactive flag
-	if len(args) > 0 && (args[0] == "--interactive" || args[0] == "-i") {
-		interactive = true
-		args = args[1:]
+	cli, err := parseFlags(args)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		fmt.Println("\nRun 'ddollar --help' for usage.")
+		os.Exit(1)
 	}
+	args = cli.command
 
 	if len(args) == 0 {
 		fmt.Println("ERROR: No command specified")
@@ -68,9 +125,76 @@ func superviseCommand(args []string) {
 		os.Exit(1)
 	}
 
+	pool := discoverPool(cli.config)
+
+	// Templates may name any provider the pool has, a local server included
+	if err := cli.supervisor.Commands.Check(pool); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	pool.SetStrategy(cli.strategy)
+
+	if len(cli.failover) > 0 {
+		if err := pool.SetFailover(cli.failover); err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Without --provider, a failover chain starts at its head
+	provider := cli.provider
+	if provider == "" && len(cli.failover) > 0 {
+		provider = cli.failover[0]
+	}
+	if provider != "" {
+		if err := pool.SetActive(provider); err != nil {
+			fmt.Printf("ERROR: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if cli.statePath != "" {
+		if err := pool.LoadState(cli.statePath); err != nil {
+			fmt.Printf("Warning: Not using pool state: %v\n", err)
+		}
+	}
+
+	if cli.lease {
+		if leaser := newLeaser(cli.brokerSocket); leaser != nil {
+			pool.SetLeaser(leaser)
+			if !pool.LeaseActive() {
+				fmt.Println("Warning: All tokens are in use by other ddollar processes; sharing one")
+			}
+		}
+	}
+
+	// Run supervisor
+	sup := supervisor.New(pool, args, cli.supervisor)
+	if err := sup.Run(); err != nil {
+		// Exit the way the command did, so callers can tell failures apart
+		var exitErr *supervisor.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// discoverPool finds tokens in the config file and environment and builds
+// a pool from them, exiting if there are none
+func discoverPool(cfg *config.Config) *tokens.Pool {
 	// Discover tokens
 	fmt.Println("Discovering API tokens...")
-	discovered := tokens.Discover()
+	if cfg.Path != "" {
+		fmt.Printf("✓ Config: %s\n", cfg.Path)
+	}
+	discovered, err := cfg.Discover()
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
 
 	if len(discovered) == 0 {
 		fmt.Println("ERROR: No API tokens found in environment.")
@@ -79,17 +203,30 @@ func superviseCommand(args []string) {
 			for _, envVar := range p.EnvVars {
 				fmt.Printf("  export %s=your-token-here\n", envVar)
 			}
+			fmt.Printf("  export %s_2=your-second-token\n", p.EnvVars[0])
 		}
+		fmt.Printf("\nOr declare [[tokens]] in %s\n", strings.Join(config.SearchPaths(), " or "))
 		os.Exit(1)
 	}
 
 	// Create token pool
 	pool := tokens.NewPool()
 	for _, pt := range discovered {
-		if err := pool.AddProvider(pt.Provider, pt.Tokens); err != nil {
+		if err := pool.AddTokens(pt.Provider, pt.Tokens); err != nil {
 			fmt.Printf("Warning: Failed to add provider %s: %v\n", pt.Provider.Name, err)
 			continue
 		}
+
+		if pt.Provider.Local {
+			fmt.Printf("✓ Local fallback: %s (from %s)\n", pt.Provider.BaseURL, pt.Tokens[0].Label())
+			continue
+		}
+
+		sources := make([]string, len(pt.Tokens))
+		for i := range pt.Tokens {
+			sources[i] = pt.Tokens[i].Label()
+		}
+		fmt.Printf("✓ %s: %d token(s) from %s\n", pt.Provider.Name, len(pt.Tokens), strings.Join(sources, ", "))
 	}
 
 	if pool.ProviderCount() == 0 {
@@ -97,10 +234,21 @@ func superviseCommand(args []string) {
 		os.Exit(1)
 	}
 
-	// Run supervisor
-	sup := supervisor.New(pool, args, interactive)
-	if err := sup.Run(); err != nil {
-		fmt.Printf("ERROR: %v\n", err)
-		os.Exit(1)
+	return pool
+}
+
+// newLeaser leases through a running daemon if there is one, otherwise
+// through lock files. Returns nil if neither is usable.
+func newLeaser(socket string) tokens.Leaser {
+	if client, err := tokens.DialBroker(socket); err == nil {
+		fmt.Printf("✓ Leasing tokens through %s\n", client)
+		return client
+	}
+
+	leaser, err := tokens.NewFileLeaser(tokens.DefaultLeaseDir())
+	if err != nil {
+		fmt.Printf("Warning: Not leasing tokens: %v\n", err)
+		return nil
 	}
+	return leaser
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/drawohara/ddollar/src/config"
+	"github.com/drawohara/ddollar/src/supervisor"
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// registerProviders makes the providers a config file declares, and their
+// limit checkers, available everywhere
+func registerProviders(cfg *config.Config) error {
+	for i, pc := range cfg.Providers {
+		checker, err := headerChecker(pc)
+		if err == nil {
+			err = tokens.RegisterProvider(pc.Provider())
+		}
+		if err != nil {
+			return fmt.Errorf("%s: providers[%d]: %w", cfg.Path, i, err)
+		}
+		supervisor.RegisterChecker(pc.Name, checker)
+	}
+	return nil
+}
+
+// headerChecker builds a declared provider's limit checker
+func headerChecker(pc config.ProviderConfig) (supervisor.HeaderChecker, error) {
+	limits := pc.Limits
+
+	var headers supervisor.HeaderMap
+	if limits.Format != "" {
+		var ok bool
+		if headers, ok = supervisor.HeaderMapByName(limits.Format); !ok {
+			return supervisor.HeaderChecker{}, fmt.Errorf("unknown limits format %q", limits.Format)
+		}
+	}
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&headers.RequestsLimit, limits.RequestsLimit},
+		{&headers.RequestsRemaining, limits.RequestsRemaining},
+		{&headers.TokensLimit, limits.TokensLimit},
+		{&headers.TokensRemaining, limits.TokensRemaining},
+		{&headers.ResetFormat, limits.ResetFormat},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if limits.Reset != nil {
+		headers.Reset = limits.Reset
+	}
+
+	switch headers.ResetFormat {
+	case "", supervisor.ResetDuration, supervisor.ResetSeconds, supervisor.ResetUnix, supervisor.ResetUnixMillis, supervisor.ResetRFC3339:
+	default:
+		return supervisor.HeaderChecker{}, fmt.Errorf("unknown reset_format %q", headers.ResetFormat)
+	}
+
+	return supervisor.HeaderChecker{
+		Probe: supervisor.Probe{
+			URL:     pc.Probe.URL,
+			Method:  pc.Probe.Method,
+			Body:    pc.Probe.Body,
+			Headers: pc.Probe.Headers,
+			Model:   pc.Probe.Model,
+		},
+		Headers: headers,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// DefaultAzureAPIVersion is the api-version used unless OPENAI_API_VERSION
+// or AZURE_OPENAI_API_VERSION says otherwise
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// AzureChecker probes a token's own deployment with a 1-token chat
+// completion. Azure reports only x-ratelimit-remaining-requests/-tokens,
+// so the limit of each deployment is taken to be the highest remaining
+// count seen for it, which is the full quota at the start of a window.
+// Tokens without a deployment are probed by listing models, which proves
+// the key works but carries no limits.
+type AzureChecker struct {
+	mu    sync.Mutex
+	peaks map[string]tokens.RateLimitStatus // deployment URL -> highest remaining counts
+}
+
+// azureAPIVersion returns the api-version query parameter to send
+func azureAPIVersion() string {
+	for _, name := range []string{"AZURE_OPENAI_API_VERSION", "OPENAI_API_VERSION"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return DefaultAzureAPIVersion
+}
+
+// ProbeRequest implements LimitChecker
+func (c *AzureChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	if token.Endpoint == "" {
+		return nil, fmt.Errorf("no endpoint for %s", token.Label())
+	}
+	endpoint := strings.TrimSuffix(token.Endpoint, "/")
+	query := "?api-version=" + url.QueryEscape(azureAPIVersion())
+
+	var req *http.Request
+	var err error
+	if token.Deployment == "" {
+		req, err = http.NewRequestWithContext(ctx, "GET", endpoint+"/openai/models"+query, nil)
+	} else {
+		body := `{"messages":[{"role":"user","content":"."}],"max_tokens":1}`
+		probeURL := endpoint + "/openai/deployments/" + url.PathEscape(token.Deployment) + "/chat/completions" + query
+		req, err = http.NewRequestWithContext(ctx, "POST", probeURL, strings.NewReader(body))
+		if err == nil {
+			req.Header.Set("content-type", "application/json")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("api-key", token.Value)
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (c *AzureChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	OpenAIHeaderMap.Parse(status, resp.Header)
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		c.applyPeaks(azureDeploymentKey(resp.Request.URL), status, resp.Header)
+	}
+	return finishStatus(status, resp)
+}
+
+// applyPeaks fills in missing limits from the highest remaining counts
+// seen for the deployment
+func (c *AzureChecker) applyPeaks(key string, s *tokens.RateLimitStatus, headers http.Header) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.peaks == nil {
+		c.peaks = make(map[string]tokens.RateLimitStatus)
+	}
+	peak := c.peaks[key]
+
+	if headers.Get("x-ratelimit-remaining-requests") != "" {
+		peak.RequestsLimit = max(peak.RequestsLimit, s.RequestsRemaining)
+		if s.RequestsLimit == 0 {
+			s.RequestsLimit = peak.RequestsLimit
+		}
+	}
+	if headers.Get("x-ratelimit-remaining-tokens") != "" {
+		peak.TokensLimit = max(peak.TokensLimit, s.TokensRemaining)
+		if s.TokensLimit == 0 {
+			s.TokensLimit = peak.TokensLimit
+		}
+	}
+	c.peaks[key] = peak
+}
+
+// azureDeploymentKey identifies the deployment a request went to
+func azureDeploymentKey(u *url.URL) string {
+	key := u.Host
+	if rest, ok := strings.CutPrefix(u.Path, "/openai/deployments/"); ok {
+		deployment, _, _ := strings.Cut(rest, "/")
+		key += "/" + deployment
+	}
+	return key
+}
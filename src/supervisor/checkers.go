@@ -0,0 +1,311 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// LimitChecker knows how to read rate limit state for one provider.
+// Adding a provider means registering a checker, not editing the monitor.
+type LimitChecker interface {
+	// ProbeRequest builds the cheapest request that reports rate limits.
+	// A non-empty model overrides the checker's default probe model.
+	ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error)
+
+	// ParseStatus extracts rate limit state from a response. It may read
+	// the body of error responses, and must cope with a nil body.
+	ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error)
+}
+
+var (
+	checkersMu sync.RWMutex
+	checkers   = make(map[string]LimitChecker) // lower-case provider name -> checker
+)
+
+func init() {
+	RegisterChecker("Anthropic", AnthropicChecker{})
+	RegisterChecker("OpenAI", OpenAIChecker{})
+	RegisterChecker("Cohere", CohereChecker{})
+	RegisterChecker("Google AI", GoogleChecker{})
+	RegisterChecker("Azure OpenAI", &AzureChecker{})
+	RegisterChecker("Local", LocalChecker{})
+
+	// OpenAI-compatible APIs, on OpenAI's headers where they match
+	RegisterChecker("Groq", OpenAIChecker{ModelsURL: "https://api.groq.com/openai/v1/models"})
+	RegisterChecker("xAI", OpenAIChecker{ModelsURL: "https://api.x.ai/v1/models"})
+	RegisterChecker("Together", HeaderChecker{
+		Probe:   Probe{URL: "https://api.together.xyz/v1/models"},
+		Headers: TogetherHeaderMap,
+	})
+	RegisterChecker("Mistral", HeaderChecker{
+		Probe:   Probe{URL: "https://api.mistral.ai/v1/models"},
+		Headers: MistralHeaderMap,
+	})
+	// DeepSeek doesn't rate limit by quota, so only a 429 triggers rotation
+	RegisterChecker("DeepSeek", HeaderChecker{
+		Probe: Probe{URL: "https://api.deepseek.com/models"},
+	})
+	RegisterChecker("OpenRouter", OpenRouterChecker{})
+}
+
+// RegisterChecker sets the limit checker for the named provider,
+// replacing any existing one
+func RegisterChecker(providerName string, checker LimitChecker) {
+	checkersMu.Lock()
+	defer checkersMu.Unlock()
+	checkers[strings.ToLower(providerName)] = checker
+}
+
+// CheckerFor returns the limit checker registered for provider, or nil
+func CheckerFor(provider *tokens.Provider) LimitChecker {
+	checkersMu.RLock()
+	defer checkersMu.RUnlock()
+	return checkers[strings.ToLower(provider.Name)]
+}
+
+// AnthropicChecker sends a 1-token message and reads anthropic-ratelimit-* headers
+type AnthropicChecker struct{}
+
+// DefaultAnthropicProbeModel is the model used for Anthropic probes unless overridden
+const DefaultAnthropicProbeModel = "claude-3-5-sonnet-20241022"
+
+// ProbeRequest implements LimitChecker
+func (AnthropicChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	if model == "" {
+		model = DefaultAnthropicProbeModel
+	}
+
+	// Minimal request: 1 token response
+	reqBody := map[string]interface{}{
+		"model":      model,
+		"max_tokens": 1,
+		"messages": []map[string]string{
+			{"role": "user", "content": "."},
+		},
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", token.Value)
+	req.Header.Set("anthropic-version", "2023-06-01")
+	req.Header.Set("content-type", "application/json")
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (AnthropicChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	AnthropicHeaderMap.Parse(status, resp.Header)
+	return finishStatus(status, resp)
+}
+
+// OpenAIChecker lists models (which costs no tokens) and reads x-ratelimit-* headers.
+// It also serves OpenAI-compatible APIs that send the same headers.
+type OpenAIChecker struct {
+	ModelsURL string // Models endpoint ("" = OpenAI's)
+}
+
+// ProbeRequest implements LimitChecker
+func (c OpenAIChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	url := c.ModelsURL
+	if url == "" {
+		url = "https://api.openai.com/v1/models"
+	}
+
+	// Minimal request: list models (doesn't consume tokens)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (OpenAIChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	OpenAIHeaderMap.Parse(status, resp.Header)
+	return finishStatus(status, resp)
+}
+
+// CohereChecker validates the key, which reports trial call limits in headers.
+// Production keys carry no limit headers, so only a 429 triggers rotation.
+type CohereChecker struct{}
+
+// ProbeRequest implements LimitChecker
+func (CohereChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.cohere.ai/v1/check-api-key", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (CohereChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	parseCohereHeaders(status, resp.Header)
+	return finishStatus(status, resp)
+}
+
+// GoogleChecker lists models. Google AI sends no limit headers; a 429 body
+// carries a RetryInfo detail with the delay until quota is available again.
+type GoogleChecker struct{}
+
+// ProbeRequest implements LimitChecker
+func (GoogleChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://generativelanguage.googleapis.com/v1beta/models?pageSize=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-goog-api-key", token.Value)
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (GoogleChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		status.ResetTime = googleRetryTime(resp.Body)
+	}
+	return finishStatus(status, resp)
+}
+
+// OpenRouterChecker reads the key's credit limit from /api/v1/key, which
+// costs nothing. Credits stand in for tokens, counted in hundredths so the
+// usage fraction survives rounding; keys without a limit never rotate on
+// credits. Rate limit headers arrive on 429s, with resets in Unix ms.
+type OpenRouterChecker struct{}
+
+// OpenRouterHeaderMap is OpenRouter's X-RateLimit-* layout
+var OpenRouterHeaderMap = HeaderMap{
+	RequestsLimit:     "x-ratelimit-limit",
+	RequestsRemaining: "x-ratelimit-remaining",
+	Reset:             []string{"x-ratelimit-reset"},
+	ResetFormat:       ResetUnixMillis,
+}
+
+// ProbeRequest implements LimitChecker
+func (OpenRouterChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://openrouter.ai/api/v1/key", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (OpenRouterChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	OpenRouterHeaderMap.Parse(status, resp.Header)
+
+	if resp.StatusCode == http.StatusOK && resp.Body != nil {
+		var payload struct {
+			Data struct {
+				Limit          *float64 `json:"limit"`
+				LimitRemaining *float64 `json:"limit_remaining"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&payload); err == nil &&
+			payload.Data.Limit != nil && payload.Data.LimitRemaining != nil {
+			status.TokensLimit = int(*payload.Data.Limit * 100)
+			status.TokensRemaining = int(*payload.Data.LimitRemaining * 100)
+		}
+	}
+
+	return finishStatus(status, resp)
+}
+
+// googleRetryTime reads the RetryInfo delay from a Google API error body
+func googleRetryTime(body io.Reader) time.Time {
+	if body == nil {
+		return time.Time{}
+	}
+
+	var payload struct {
+		Error struct {
+			Details []struct {
+				Type       string `json:"@type"`
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&payload); err != nil {
+		return time.Time{}
+	}
+
+	for _, d := range payload.Error.Details {
+		if strings.HasSuffix(d.Type, "google.rpc.RetryInfo") {
+			if delay, err := time.ParseDuration(d.RetryDelay); err == nil {
+				return time.Now().Add(delay)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// finishStatus applies the response code to a parsed status: auth failures
+// are errors, and a 429 means the token is exhausted whatever the headers say
+func finishStatus(status *tokens.RateLimitStatus, resp *http.Response) (*tokens.RateLimitStatus, error) {
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, fmt.Errorf("token rejected (HTTP %d)", resp.StatusCode)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		markExhausted(status, resp.Header)
+	case resp.StatusCode >= 400 && status.RequestsLimit == 0 && status.TokensLimit == 0:
+		return nil, fmt.Errorf("probe failed (HTTP %d)", resp.StatusCode)
+	}
+	return status, nil
+}
+
+// markExhausted records a 429: no requests remain until retry-after
+func markExhausted(s *tokens.RateLimitStatus, headers http.Header) {
+	if s.RequestsLimit == 0 {
+		s.RequestsLimit = 1
+	}
+	s.RequestsRemaining = 0
+
+	if retryAfter := parseRetryAfter(headers); retryAfter > 0 {
+		if reset := time.Now().Add(retryAfter); reset.After(s.ResetTime) {
+			s.ResetTime = reset
+		}
+	}
+}
+
+// parseRetryAfter reads a retry-after header in seconds or as an HTTP date,
+// returning 0 when it is missing, malformed or already past
+func parseRetryAfter(headers http.Header) time.Duration {
+	value := headers.Get("retry-after")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,268 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// resetWant says what a parsed ResetTime should be
+type resetWant struct {
+	in time.Duration // About this long from now, or...
+	at time.Time     // ...exactly this, or neither for zero
+}
+
+func (w resetWant) check(t *testing.T, got time.Time) {
+	t.Helper()
+	switch {
+	case w.in != 0:
+		if d := time.Until(got); d < w.in-2*time.Second || d > w.in+time.Second {
+			t.Errorf("reset in %v, want about %v", d.Round(time.Second), w.in)
+		}
+	case !w.at.IsZero():
+		if !got.Equal(w.at) {
+			t.Errorf("reset at %v, want %v", got, w.at)
+		}
+	default:
+		if !got.IsZero() {
+			t.Errorf("reset at %v, want none", got)
+		}
+	}
+}
+
+func TestCheckerFixtures(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		code     int
+		headers  map[string]string
+		body     string
+
+		requestsLimit, requestsRemaining int
+		tokensLimit, tokensRemaining     int
+		reset                            resetWant
+		err                              bool
+	}{
+		{
+			name:     "anthropic",
+			provider: "Anthropic",
+			code:     200,
+			headers: map[string]string{
+				"anthropic-ratelimit-requests-limit":     "50",
+				"anthropic-ratelimit-requests-remaining": "49",
+				"anthropic-ratelimit-tokens-limit":       "40000",
+				"anthropic-ratelimit-tokens-remaining":   "39000",
+				"anthropic-ratelimit-requests-reset":     "2030-01-01T00:00:01Z",
+				"anthropic-ratelimit-tokens-reset":       "2030-01-01T00:00:07Z",
+			},
+			requestsLimit: 50, requestsRemaining: 49,
+			tokensLimit: 40000, tokensRemaining: 39000,
+			reset: resetWant{at: time.Date(2030, 1, 1, 0, 0, 7, 0, time.UTC)},
+		},
+		{
+			name:     "openai",
+			provider: "OpenAI",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "5000",
+				"x-ratelimit-remaining-requests": "4999",
+				"x-ratelimit-limit-tokens":       "800000",
+				"x-ratelimit-remaining-tokens":   "799000",
+				"x-ratelimit-reset-requests":     "12ms",
+				"x-ratelimit-reset-tokens":       "1m0s",
+			},
+			requestsLimit: 5000, requestsRemaining: 4999,
+			tokensLimit: 800000, tokensRemaining: 799000,
+			reset: resetWant{in: time.Minute},
+		},
+		{
+			name:     "groq",
+			provider: "Groq",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "14400",
+				"x-ratelimit-remaining-requests": "14370",
+				"x-ratelimit-limit-tokens":       "18000",
+				"x-ratelimit-remaining-tokens":   "17997",
+				"x-ratelimit-reset-requests":     "2m59.56s",
+				"x-ratelimit-reset-tokens":       "7.66s",
+			},
+			requestsLimit: 14400, requestsRemaining: 14370,
+			tokensLimit: 18000, tokensRemaining: 17997,
+			reset: resetWant{in: 3 * time.Minute},
+		},
+		{
+			name:     "xai",
+			provider: "xAI",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimit-limit-requests":     "60",
+				"x-ratelimit-remaining-requests": "59",
+				"x-ratelimit-limit-tokens":       "100000",
+				"x-ratelimit-remaining-tokens":   "99000",
+			},
+			requestsLimit: 60, requestsRemaining: 59,
+			tokensLimit: 100000, tokensRemaining: 99000,
+		},
+		{
+			name:     "together",
+			provider: "Together",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimit-limit":      "100",
+				"x-ratelimit-remaining":  "97",
+				"x-ratelimit-reset":      "30",
+				"x-tokenlimit-limit":     "200000",
+				"x-tokenlimit-remaining": "180000",
+			},
+			requestsLimit: 100, requestsRemaining: 97,
+			tokensLimit: 200000, tokensRemaining: 180000,
+			reset: resetWant{in: 30 * time.Second},
+		},
+		{
+			name:     "mistral",
+			provider: "Mistral",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimitbysize-limit-minute":     "500000",
+				"x-ratelimitbysize-remaining-minute": "499800",
+			},
+			tokensLimit: 500000, tokensRemaining: 499800,
+		},
+		{
+			name:     "deepseek has no limit headers",
+			provider: "DeepSeek",
+			code:     200,
+		},
+		{
+			name:          "deepseek 429 with retry-after",
+			provider:      "DeepSeek",
+			code:          429,
+			headers:       map[string]string{"retry-after": "20"},
+			requestsLimit: 1, requestsRemaining: 0,
+			reset: resetWant{in: 20 * time.Second},
+		},
+		{
+			name:        "openrouter credits",
+			provider:    "OpenRouter",
+			code:        200,
+			body:        `{"data":{"label":"sk-or-v1-abc","limit":10,"limit_remaining":2.5,"usage":7.5}}`,
+			tokensLimit: 1000, tokensRemaining: 250,
+		},
+		{
+			name:     "openrouter without a credit limit",
+			provider: "OpenRouter",
+			code:     200,
+			body:     `{"data":{"label":"sk-or-v1-abc","limit":null,"limit_remaining":null,"usage":7.5}}`,
+		},
+		{
+			name:     "openrouter 429 resets in unix ms",
+			provider: "OpenRouter",
+			code:     429,
+			headers: map[string]string{
+				"x-ratelimit-limit":     "20",
+				"x-ratelimit-remaining": "0",
+				"x-ratelimit-reset":     "1893456000123",
+			},
+			requestsLimit: 20, requestsRemaining: 0,
+			reset: resetWant{at: time.UnixMilli(1893456000123)},
+		},
+		{
+			name:     "malformed reset keeps the rest",
+			provider: "Together",
+			code:     200,
+			headers: map[string]string{
+				"x-ratelimit-limit":     "100",
+				"x-ratelimit-remaining": "40",
+				"x-ratelimit-reset":     "soon",
+			},
+			requestsLimit: 100, requestsRemaining: 40,
+		},
+		{
+			name:     "malformed openrouter reset",
+			provider: "OpenRouter",
+			code:     429,
+			headers: map[string]string{
+				"x-ratelimit-limit":     "20",
+				"x-ratelimit-remaining": "0",
+				"x-ratelimit-reset":     "2025-01-01T00:00:00Z",
+			},
+			requestsLimit: 20, requestsRemaining: 0,
+		},
+		{
+			name:     "missing headers on an error",
+			provider: "Groq",
+			code:     500,
+			err:      true,
+		},
+		{
+			name:     "rejected key",
+			provider: "Mistral",
+			code:     401,
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := tokens.GetProviderByName(tt.provider)
+			if provider == nil {
+				t.Fatalf("no provider %s", tt.provider)
+			}
+			checker := CheckerFor(provider)
+			if checker == nil {
+				t.Fatalf("no checker for %s", tt.provider)
+			}
+
+			resp := &http.Response{
+				StatusCode: tt.code,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(tt.body)),
+			}
+			for name, value := range tt.headers {
+				resp.Header.Set(name, value)
+			}
+
+			status, err := checker.ParseStatus(resp)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if status.RequestsLimit != tt.requestsLimit || status.RequestsRemaining != tt.requestsRemaining {
+				t.Errorf("requests %d/%d, want %d/%d", status.RequestsRemaining, status.RequestsLimit, tt.requestsRemaining, tt.requestsLimit)
+			}
+			if status.TokensLimit != tt.tokensLimit || status.TokensRemaining != tt.tokensRemaining {
+				t.Errorf("tokens %d/%d, want %d/%d", status.TokensRemaining, status.TokensLimit, tt.tokensRemaining, tt.tokensLimit)
+			}
+			tt.reset.check(t, status.ResetTime)
+		})
+	}
+}
+
+func TestOpenAICompatibleProbeURLs(t *testing.T) {
+	for name, want := range map[string]string{
+		"OpenAI": "https://api.openai.com/v1/models",
+		"Groq":   "https://api.groq.com/openai/v1/models",
+		"xAI":    "https://api.x.ai/v1/models",
+	} {
+		provider := tokens.GetProviderByName(name)
+		req, err := CheckerFor(provider).ProbeRequest(context.Background(), &tokens.Token{Value: "k", Provider: provider}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.URL.String(); got != want {
+			t.Errorf("%s probes %s, want %s", name, got, want)
+		}
+	}
+}
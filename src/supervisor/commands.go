@@ -0,0 +1,108 @@
+package supervisor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// CommandTemplate says how to launch the command against one provider, for
+// tools that pick their vendor from a flag or env var rather than from
+// which API key is set.
+//
+// In Command, "{command}" expands to the original command line and
+// "{args}" to its arguments. In Command and Env, "{provider}" expands to
+// the provider name, "{token}" to what the child should use as its API
+// key (a placeholder in proxy mode) and "{base_url}" to the API root it
+// should talk to.
+type CommandTemplate struct {
+	Command []string          // Replaces the command; empty keeps it
+	Env     map[string]string // Extra environment variables
+}
+
+// Commands maps provider names or domains to their launch templates
+type Commands map[string]CommandTemplate
+
+// lookup finds the template for provider. A key spelled exactly like the
+// name wins, then one spelled exactly like the domain, then the same again
+// ignoring case, so the choice never depends on map order.
+func (c Commands) lookup(provider *tokens.Provider) (CommandTemplate, bool) {
+	if tmpl, ok := c[provider.Name]; ok {
+		return tmpl, true
+	}
+	if tmpl, ok := c[provider.Domain]; ok {
+		return tmpl, true
+	}
+
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, match := range []string{provider.Name, provider.Domain} {
+		for _, key := range keys {
+			if strings.EqualFold(key, match) {
+				return c[key], true
+			}
+		}
+	}
+	return CommandTemplate{}, false
+}
+
+// Check reports the first template for a provider neither the pool nor
+// the known providers have. Known providers without tokens this run are
+// fine; their templates just go unused.
+func (c Commands) Check(pool *tokens.Pool) error {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if pool.Lookup(key) == "" && tokens.GetProviderByName(key) == nil {
+			return fmt.Errorf("commands: unknown provider %q", key)
+		}
+	}
+	return nil
+}
+
+// expand returns the command line and extra environment to launch command
+// with against provider
+func (c Commands) expand(provider *tokens.Provider, command []string, key, baseURL string) ([]string, []string) {
+	tmpl, ok := c.lookup(provider)
+	if !ok {
+		return command, nil
+	}
+
+	replacer := strings.NewReplacer("{provider}", provider.Name, "{token}", key, "{base_url}", baseURL)
+
+	expanded := command
+	if len(tmpl.Command) > 0 {
+		expanded = nil
+		for _, arg := range tmpl.Command {
+			switch arg {
+			case "{command}":
+				expanded = append(expanded, command...)
+			case "{args}":
+				expanded = append(expanded, command[1:]...)
+			default:
+				expanded = append(expanded, replacer.Replace(arg))
+			}
+		}
+	}
+
+	// Sorted so the environment is the same on every launch
+	names := make([]string, 0, len(tmpl.Env))
+	for name := range tmpl.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	env := make([]string, 0, len(names))
+	for _, name := range names {
+		env = append(env, name+"="+replacer.Replace(tmpl.Env[name]))
+	}
+
+	return expanded, env
+}
@@ -0,0 +1,50 @@
+package supervisor
+
+import (
+	"testing"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+func TestCommandsLookupPrefersName(t *testing.T) {
+	groq := tokens.GetProviderByName("Groq")
+	commands := Commands{
+		groq.Domain: {Command: []string{"by-domain"}},
+		"GROQ":      {Command: []string{"by-name-any-case"}},
+		"Groq":      {Command: []string{"by-name"}},
+	}
+
+	// Map order varies from run to run; the winner must not
+	for i := 0; i < 20; i++ {
+		tmpl, ok := commands.lookup(groq)
+		if !ok || tmpl.Command[0] != "by-name" {
+			t.Fatalf("picked %v, want the exact name's template", tmpl.Command)
+		}
+	}
+
+	delete(commands, "Groq")
+	if tmpl, _ := commands.lookup(groq); tmpl.Command[0] != "by-domain" {
+		t.Errorf("picked %v, want the exact domain's template", tmpl.Command)
+	}
+	delete(commands, groq.Domain)
+	if tmpl, _ := commands.lookup(groq); tmpl.Command[0] != "by-name-any-case" {
+		t.Errorf("picked %v, want the name ignoring case", tmpl.Command)
+	}
+}
+
+func TestCommandsCheckUsesThePool(t *testing.T) {
+	pool := tokens.NewPool()
+	local := tokens.LocalTokens("http://localhost:11434/v1", tokens.LocalURLEnv)
+	if err := pool.AddTokens(local.Provider, local.Tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"Local", "localhost:11434", "Anthropic", "api.groq.com"} {
+		if err := (Commands{key: {}}).Check(pool); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	if err := (Commands{"nobody": {}}).Check(pool); err == nil {
+		t.Error("accepted a template for an unknown provider")
+	}
+}
@@ -0,0 +1,103 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Event kinds in the supervisor's event log
+const (
+	eventLaunch  = "launch"  // The command was started
+	eventStop    = "stop"    // ddollar stopped the command, e.g. to rotate
+	eventSwap    = "swap"    // The proxy switched tokens without a restart
+	eventExit    = "exit"    // The command exited on its own
+	eventRestart = "restart" // The restart policy restarted the command
+	eventGiveUp  = "give up" // The restart policy stopped restarting it
+)
+
+// event is one entry in the supervisor's event log
+type event struct {
+	Time   time.Time
+	Kind   string
+	Detail string
+}
+
+// logEvent appends an entry to the event log
+func (s *Supervisor) logEvent(kind, format string, args ...any) {
+	s.events = append(s.events, event{Time: time.Now(), Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// ExitError is returned by Run when the command exits unsuccessfully.
+// Code is the command's exit status, or 128+N if it was killed by signal
+// N, ready to be passed to os.Exit.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command %s", describeExit(e.Err))
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitCode returns the exit status behind a Wait error, using the shell's
+// 128+N convention for a command killed by signal N
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	default:
+		return 1
+	}
+}
+
+// describeExit says how a command ended, given its Wait error
+func describeExit(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "exited with code 0"
+	case errors.As(err, &exitErr):
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return fmt.Sprintf("killed by signal %d (%v)", int(status.Signal()), status.Signal())
+		}
+		return fmt.Sprintf("exited with code %d", exitErr.ExitCode())
+	default:
+		return fmt.Sprintf("failed: %v", err)
+	}
+}
+
+// printEventLog prints the event log, telling the exits ddollar caused
+// (rotations, failovers) apart from the command's own
+func (s *Supervisor) printEventLog() {
+	if len(s.events) == 0 {
+		return
+	}
+
+	launches, stops, restarts := 0, 0, 0
+	fmt.Printf("\nSession (%s):\n", formatDuration(time.Since(s.events[0].Time)))
+	for _, e := range s.events {
+		switch e.Kind {
+		case eventLaunch:
+			launches++
+		case eventStop:
+			stops++
+		case eventRestart:
+			restarts++
+		}
+		fmt.Printf("  %s  %-7s  %s\n", e.Time.Format("15:04:05"), e.Kind, e.Detail)
+	}
+	fmt.Printf("  %d launch(es), %d stopped by ddollar, %d restarted after exiting\n", launches, stops, restarts)
+}
@@ -0,0 +1,40 @@
+package supervisor
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestExitCodeAndDescription(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no sh or signals")
+	}
+	run := func(script string) error {
+		return exec.Command("sh", "-c", script).Run()
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantDesc string
+	}{
+		{"success", run("exit 0"), 0, "exited with code 0"},
+		{"exit code", run("exit 3"), 3, "exited with code 3"},
+		{"signal", run("kill -TERM $$"), 143, "killed by signal 15 (terminated)"},
+		{"start failure", errors.New("exec: not found"), 1, "failed: exec: not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.wantCode {
+				t.Errorf("exitCode = %d, want %d", got, tt.wantCode)
+			}
+			if got := describeExit(tt.err); got != tt.wantDesc {
+				t.Errorf("describeExit = %q, want %q", got, tt.wantDesc)
+			}
+		})
+	}
+}
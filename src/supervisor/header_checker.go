@@ -0,0 +1,203 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// Reset header formats understood by HeaderMap
+const (
+	ResetDuration   = "duration" // Go-style durations like "1m23s" (OpenAI)
+	ResetSeconds    = "seconds"  // Seconds until reset
+	ResetUnix       = "unix"     // Unix timestamp of the reset
+	ResetUnixMillis = "unix_ms"  // Unix timestamp in milliseconds (OpenRouter)
+	ResetRFC3339    = "rfc3339"  // Timestamp like "2024-01-01T00:00:00Z" (Anthropic)
+)
+
+// HeaderMap names the response headers that carry a provider's limits.
+// Empty names are skipped.
+type HeaderMap struct {
+	RequestsLimit     string
+	RequestsRemaining string
+	TokensLimit       string
+	TokensRemaining   string
+	Reset             []string // Reset headers; the latest reset wins
+	ResetFormat       string   // One of the Reset* formats (default ResetDuration)
+}
+
+// OpenAIHeaderMap is the x-ratelimit-* layout most OpenAI-compatible APIs use
+var OpenAIHeaderMap = HeaderMap{
+	RequestsLimit:     "x-ratelimit-limit-requests",
+	RequestsRemaining: "x-ratelimit-remaining-requests",
+	TokensLimit:       "x-ratelimit-limit-tokens",
+	TokensRemaining:   "x-ratelimit-remaining-tokens",
+	Reset:             []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"},
+	ResetFormat:       ResetDuration,
+}
+
+// AnthropicHeaderMap is the anthropic-ratelimit-* layout
+var AnthropicHeaderMap = HeaderMap{
+	RequestsLimit:     "anthropic-ratelimit-requests-limit",
+	RequestsRemaining: "anthropic-ratelimit-requests-remaining",
+	TokensLimit:       "anthropic-ratelimit-tokens-limit",
+	TokensRemaining:   "anthropic-ratelimit-tokens-remaining",
+	Reset:             []string{"anthropic-ratelimit-requests-reset", "anthropic-ratelimit-tokens-reset"},
+	ResetFormat:       ResetRFC3339,
+}
+
+// TogetherHeaderMap is Together's layout: unsuffixed x-ratelimit-* for
+// requests with a reset in seconds, and x-tokenlimit-* for tokens
+var TogetherHeaderMap = HeaderMap{
+	RequestsLimit:     "x-ratelimit-limit",
+	RequestsRemaining: "x-ratelimit-remaining",
+	TokensLimit:       "x-tokenlimit-limit",
+	TokensRemaining:   "x-tokenlimit-remaining",
+	Reset:             []string{"x-ratelimit-reset"},
+	ResetFormat:       ResetSeconds,
+}
+
+// MistralHeaderMap is Mistral's per-minute token budget. It sends no
+// reset, so a cooldown falls back to a minute.
+var MistralHeaderMap = HeaderMap{
+	TokensLimit:     "x-ratelimitbysize-limit-minute",
+	TokensRemaining: "x-ratelimitbysize-remaining-minute",
+}
+
+// HeaderMapByName returns a built-in header layout: "openai", "anthropic",
+// "together", "mistral" or "openrouter"
+func HeaderMapByName(name string) (HeaderMap, bool) {
+	switch strings.ToLower(name) {
+	case "openai":
+		return OpenAIHeaderMap, true
+	case "anthropic":
+		return AnthropicHeaderMap, true
+	case "together":
+		return TogetherHeaderMap, true
+	case "mistral":
+		return MistralHeaderMap, true
+	case "openrouter":
+		return OpenRouterHeaderMap, true
+	}
+	return HeaderMap{}, false
+}
+
+// Parse reads limits from headers into s. Values it can't read are
+// skipped rather than dropping the whole status. The built-in checkers
+// parse with it too.
+func (m HeaderMap) Parse(s *tokens.RateLimitStatus, headers http.Header) {
+	if m.RequestsLimit != "" {
+		s.RequestsLimit = parseInt(headers.Get(m.RequestsLimit))
+	}
+	if m.RequestsRemaining != "" {
+		s.RequestsRemaining = parseInt(headers.Get(m.RequestsRemaining))
+	}
+	if m.TokensLimit != "" {
+		s.TokensLimit = parseInt(headers.Get(m.TokensLimit))
+	}
+	if m.TokensRemaining != "" {
+		s.TokensRemaining = parseInt(headers.Get(m.TokensRemaining))
+	}
+
+	for _, name := range m.Reset {
+		value := headers.Get(name)
+		if value == "" {
+			continue
+		}
+		resetTime, err := parseReset(value, m.ResetFormat)
+		if err == nil && resetTime.After(s.ResetTime) {
+			s.ResetTime = resetTime
+		}
+	}
+}
+
+// parseReset turns a reset header value into a time
+func parseReset(value, format string) (time.Time, error) {
+	switch format {
+	case "", ResetDuration:
+		d, err := time.ParseDuration(value)
+		return time.Now().Add(d), err
+	case ResetSeconds:
+		seconds, err := strconv.ParseFloat(value, 64)
+		return time.Now().Add(time.Duration(seconds * float64(time.Second))), err
+	case ResetUnix:
+		seconds, err := strconv.ParseFloat(value, 64)
+		return time.Unix(0, int64(seconds*float64(time.Second))), err
+	case ResetUnixMillis:
+		millis, err := strconv.ParseInt(value, 10, 64)
+		return time.UnixMilli(millis), err
+	case ResetRFC3339:
+		return time.Parse(time.RFC3339, value)
+	}
+	return time.Time{}, fmt.Errorf("unknown reset format %q", format)
+}
+
+// Probe describes the request a HeaderChecker sends. "{model}" in the URL
+// or body is replaced by the probe model.
+type Probe struct {
+	URL     string
+	Method  string            // Default GET, or POST when there is a body
+	Body    string            // Sent as-is
+	Headers map[string]string // Extra request headers, e.g. content-type
+	Model   string            // Default probe model
+}
+
+// HeaderChecker probes a configured endpoint and reads limits from
+// configured headers. It backs providers declared in config, and built-ins
+// whose limits are plain headers.
+type HeaderChecker struct {
+	Probe   Probe
+	Headers HeaderMap
+}
+
+// ProbeRequest implements LimitChecker
+func (c HeaderChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	if c.Probe.URL == "" {
+		return nil, fmt.Errorf("no probe URL for %s", token.Provider.Name)
+	}
+	if model == "" {
+		model = c.Probe.Model
+	}
+
+	method := c.Probe.Method
+	if method == "" {
+		method = http.MethodGet
+		if c.Probe.Body != "" {
+			method = http.MethodPost
+		}
+	}
+
+	url := strings.ReplaceAll(c.Probe.URL, "{model}", model)
+	var req *http.Request
+	var err error
+	if c.Probe.Body != "" {
+		body := strings.ReplaceAll(c.Probe.Body, "{model}", model)
+		req, err = http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range c.Probe.Headers {
+		req.Header.Set(name, value)
+	}
+	if token.Provider.AuthHeader != "" {
+		req.Header.Set(token.Provider.AuthHeader, token.Provider.AuthPrefix+token.Value)
+	}
+
+	return req, nil
+}
+
+// ParseStatus implements LimitChecker
+func (c HeaderChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	status := &tokens.RateLimitStatus{}
+	c.Headers.Parse(status, resp.Header)
+	return finishStatus(status, resp)
+}
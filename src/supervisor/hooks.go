@@ -0,0 +1,69 @@
+package supervisor
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// Hooks are shell commands run on supervisor events. Each runs to
+// completion with ddollar's stdout and stderr, and with DDOLLAR_EVENT and
+// event details in its environment. The env vars tokens are discovered
+// from, and any other holding a pool token, are left out of it, so hooks
+// never see token values.
+type Hooks struct {
+	OnRotate    string // After switching tokens: DDOLLAR_FROM, DDOLLAR_TO
+	OnExhausted string // When every token is cooling down: DDOLLAR_RESET_AT
+	OnExit      string // When the command finishes: DDOLLAR_EXIT_CODE
+}
+
+// hookEnviron returns ddollar's environment without token env vars or
+// vars holding one of pool's tokens, like those [[tokens]] entries name
+func hookEnviron(pool *tokens.Pool) []string {
+	secret := make(map[string]bool)
+	for _, domain := range pool.Domains() {
+		for _, t := range pool.Tokens(domain) {
+			if !t.Provider.Local {
+				secret[t.Value] = true
+			}
+		}
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !tokens.IsTokenEnvVar(name) && !secret[strings.TrimSpace(value)] {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// runHook runs command through the shell, if set
+func (s *Supervisor) runHook(event, command string, env ...string) {
+	if command == "" {
+		return
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(hookEnviron(s.pool), "DDOLLAR_EVENT="+event)
+	if active := s.pool.Active(); active != nil {
+		cmd.Env = append(cmd.Env, "DDOLLAR_PROVIDER="+active.Name)
+	}
+	cmd.Env = append(cmd.Env, env...)
+
+	if err := cmd.Run(); err != nil {
+		log.Printf("Warning: %s hook failed: %v", event, err)
+	}
+}
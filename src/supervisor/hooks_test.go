@@ -0,0 +1,49 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+func TestHookEnvironLeavesOutTokens(t *testing.T) {
+	for name, value := range map[string]string{
+		"ANTHROPIC_API_KEY":        "sk-ant-0",
+		"ANTHROPIC_API_KEY_2":      "sk-ant-2",
+		"ANTHROPIC_API_KEYS":       "sk-ant-a,sk-ant-b",
+		"ANTHROPIC_API_KEYS_FILE":  "/keys",
+		"OPENAI_API_KEY_TEAM_A":    "sk-team",
+		"GROQ_API_KEY":             "gsk-0",
+		"AZURE_OPENAI_ENDPOINT":    "https://example.openai.azure.com",
+		"DDOLLAR_TEST_KEEP":        "kept",
+		"ANTHROPIC_API_KEY_BAD_":   "not a token var",
+		"NOT_ANTHROPIC_API_KEY_XY": "kept too",
+		"WORK_ANTHROPIC_KEY":       "sk-declared",
+	} {
+		t.Setenv(name, value)
+	}
+
+	// As if [[tokens]] declared env = "WORK_ANTHROPIC_KEY"
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(tokens.GetProviderByName("Anthropic"), []string{"sk-declared"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+	for _, kv := range hookEnviron(pool) {
+		name, value, _ := strings.Cut(kv, "=")
+		env[name] = value
+		if strings.HasPrefix(value, "sk-") || strings.HasPrefix(value, "gsk-") {
+			t.Errorf("hook sees token var %s", name)
+		}
+	}
+	if env["ANTHROPIC_API_KEYS_FILE"] != "" {
+		t.Error("hook sees the key list file")
+	}
+	for _, name := range []string{"DDOLLAR_TEST_KEEP", "AZURE_OPENAI_ENDPOINT", "ANTHROPIC_API_KEY_BAD_", "NOT_ANTHROPIC_API_KEY_XY"} {
+		if _, ok := env[name]; !ok {
+			t.Errorf("hook lost %s", name)
+		}
+	}
+}
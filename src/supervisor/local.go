@@ -0,0 +1,34 @@
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// LocalChecker health checks a local OpenAI-compatible server by listing
+// its models. A local server has no rate limits, so a healthy one reports
+// an empty status and an unreachable or failing one an error.
+type LocalChecker struct{}
+
+// ProbeRequest implements LimitChecker
+func (LocalChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(token.Endpoint, "/")+"/models", nil)
+}
+
+// ParseStatus implements LimitChecker
+func (LocalChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("local server unhealthy (HTTP %d)", resp.StatusCode)
+	}
+	return &tokens.RateLimitStatus{}, nil
+}
+
+// CheckHealth probes a local server once
+func (m *Monitor) CheckHealth(ctx context.Context, token *tokens.Token) error {
+	_, err := m.checkLimits(ctx, token)
+	return err
+}
@@ -1,8 +1,7 @@
 package supervisor
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -14,18 +13,10 @@ import (
 
 // Monitor checks rate limits by making periodic API calls
 type Monitor struct {
-	interval  time.Duration
-	threshold float64 // Rotate when usage exceeds this percentage (0.95 = 95%)
-}
-
-// RateLimitStatus represents the current rate limit state
-type RateLimitStatus struct {
-	RequestsLimit     int
-	RequestsRemaining int
-	TokensLimit       int
-	TokensRemaining   int
-	ResetTime         time.Time
-	Provider          string
+	interval   time.Duration
+	threshold  float64      // Rotate when usage exceeds this percentage (0.95 = 95%)
+	probeModel string       // Overrides the checker's default probe model when set
+	pool       *tokens.Pool // Receives every status observed, if set
 }
 
 // NewMonitor creates a monitor that checks limits at the specified interval
@@ -36,15 +27,44 @@ func NewMonitor(interval time.Duration, threshold float64) *Monitor {
 	}
 }
 
-// Watch continuously monitors rate limits and sends status updates on the channel
-func (m *Monitor) Watch(token *tokens.Token, statusChan chan *RateLimitStatus) {
+// SetPool makes the monitor record every status it observes in pool
+func (m *Monitor) SetPool(pool *tokens.Pool) {
+	m.pool = pool
+}
+
+// Watch monitors rate limits for token until ctx is cancelled, sending a
+// status on statusChan whenever rotation is needed. It blocks, so callers
+// run it in its own goroutine and cancel ctx before watching another token.
+func (m *Monitor) Watch(ctx context.Context, token *tokens.Token, statusChan chan<- *tokens.RateLimitStatus) {
 	ticker := time.NewTicker(m.interval)
 	defer ticker.Stop()
 
 	log.Printf("Monitor: Started watching token for %s (checking every %s)", token.Provider.Name, m.interval)
 
-	for range ticker.C {
-		status, err := m.checkLimits(token)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err := m.checkLimits(ctx, token)
+		if ctx.Err() != nil {
+			return
+		}
+		if token.Provider.Local {
+			// The check is a health check. A server that stopped answering
+			// is reported as exhausted so the supervisor moves off it.
+			if err == nil {
+				continue
+			}
+			log.Printf("Monitor: Local server unavailable: %v", err)
+			select {
+			case statusChan <- &tokens.RateLimitStatus{RequestsLimit: 1, Provider: token.Provider.Name}:
+			case <-ctx.Done():
+			}
+			return
+		}
 		if err != nil {
 			log.Printf("Monitor: Error checking limits: %v", err)
 			continue
@@ -55,138 +75,71 @@ func (m *Monitor) Watch(token *tokens.Token, statusChan chan *RateLimitStatus) {
 			status.RequestsLimit-status.RequestsRemaining, status.RequestsLimit, status.RequestsPercentUsed(),
 			status.TokensLimit-status.TokensRemaining, status.TokensLimit, status.TokensPercentUsed())
 
+		if m.pool != nil {
+			m.pool.RecordStatus(token.Value, status)
+		}
+
 		// Send status if rotation needed
 		if status.ShouldRotate(m.threshold) {
-			statusChan <- status
+			select {
+			case statusChan <- status:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
 
-// checkLimits makes a minimal API call to check rate limit headers
-func (m *Monitor) checkLimits(token *tokens.Token) (*RateLimitStatus, error) {
-	var resp *http.Response
-	var err error
-
-	switch token.Provider.Name {
-	case "Anthropic":
-		resp, err = m.checkAnthropic(token)
-	case "OpenAI":
-		resp, err = m.checkOpenAI(token)
-	default:
-		return nil, fmt.Errorf("unsupported provider: %s", token.Provider.Name)
-	}
-
-	if err != nil {
-		return nil, err
+// Report feeds a status captured outside the monitor (e.g. by the proxy)
+// into the same rotation decision as a probe. It never blocks: if the
+// supervisor is busy rotating, the status is dropped.
+func (m *Monitor) Report(status *tokens.RateLimitStatus, statusChan chan<- *tokens.RateLimitStatus) {
+	if !status.ShouldRotate(m.threshold) {
+		return
 	}
-	defer resp.Body.Close()
 
-	// Parse provider-specific headers
-	status := &RateLimitStatus{Provider: token.Provider.Name}
-
-	if token.Provider.Name == "Anthropic" {
-		status.parseAnthropicHeaders(resp.Header)
-	} else if token.Provider.Name == "OpenAI" {
-		status.parseOpenAIHeaders(resp.Header)
-	}
-
-	return status, nil
-}
+	log.Printf("Monitor: %s - Requests: %d/%d (%.1f%%), Tokens: %d/%d (%.1f%%) (observed)",
+		status.Provider,
+		status.RequestsLimit-status.RequestsRemaining, status.RequestsLimit, status.RequestsPercentUsed(),
+		status.TokensLimit-status.TokensRemaining, status.TokensLimit, status.TokensPercentUsed())
 
-// checkAnthropic makes a minimal API call to Anthropic
-func (m *Monitor) checkAnthropic(token *tokens.Token) (*http.Response, error) {
-	// Minimal request: 1 token response
-	reqBody := map[string]interface{}{
-		"model":      "claude-3-5-sonnet-20241022",
-		"max_tokens": 1,
-		"messages": []map[string]string{
-			{"role": "user", "content": "."},
-		},
+	select {
+	case statusChan <- status:
+	default:
 	}
-
-	body, _ := json.Marshal(reqBody)
-	req, _ := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(body))
-	req.Header.Set("x-api-key", token.Value)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("content-type", "application/json")
-
-	return http.DefaultClient.Do(req)
-}
-
-// checkOpenAI makes a minimal API call to OpenAI
-func (m *Monitor) checkOpenAI(token *tokens.Token) (*http.Response, error) {
-	// Minimal request: list models (doesn't consume tokens)
-	req, _ := http.NewRequest("GET", "https://api.openai.com/v1/models", nil)
-	req.Header.Set("Authorization", "Bearer "+token.Value)
-
-	return http.DefaultClient.Do(req)
 }
 
-// parseAnthropicHeaders extracts rate limit info from Anthropic response headers
-func (s *RateLimitStatus) parseAnthropicHeaders(headers http.Header) {
-	s.RequestsLimit = parseInt(headers.Get("anthropic-ratelimit-requests-limit"))
-	s.RequestsRemaining = parseInt(headers.Get("anthropic-ratelimit-requests-remaining"))
-	s.TokensLimit = parseInt(headers.Get("anthropic-ratelimit-tokens-limit"))
-	s.TokensRemaining = parseInt(headers.Get("anthropic-ratelimit-tokens-remaining"))
-
-	// Parse reset time
-	resetStr := headers.Get("anthropic-ratelimit-requests-reset")
-	if resetTime, err := time.Parse(time.RFC3339, resetStr); err == nil {
-		s.ResetTime = resetTime
+// checkLimits makes a minimal API call through the provider's checker
+func (m *Monitor) checkLimits(ctx context.Context, token *tokens.Token) (*tokens.RateLimitStatus, error) {
+	checker := CheckerFor(token.Provider)
+	if checker == nil {
+		return nil, fmt.Errorf("no limit checker for provider: %s", token.Provider.Name)
 	}
-}
 
-// parseOpenAIHeaders extracts rate limit info from OpenAI response headers
-func (s *RateLimitStatus) parseOpenAIHeaders(headers http.Header) {
-	s.RequestsLimit = parseInt(headers.Get("x-ratelimit-limit-requests"))
-	s.RequestsRemaining = parseInt(headers.Get("x-ratelimit-remaining-requests"))
-	s.TokensLimit = parseInt(headers.Get("x-ratelimit-limit-tokens"))
-	s.TokensRemaining = parseInt(headers.Get("x-ratelimit-remaining-tokens"))
-
-	// Parse reset time (OpenAI uses duration like "1m23s")
-	resetStr := headers.Get("x-ratelimit-reset-requests")
-	if duration, err := time.ParseDuration(resetStr); err == nil {
-		s.ResetTime = time.Now().Add(duration)
+	req, err := checker.ProbeRequest(ctx, token, m.probeModel)
+	if err != nil {
+		return nil, err
 	}
-}
-
-// ShouldRotate returns true if usage exceeds the threshold
-func (s *RateLimitStatus) ShouldRotate(threshold float64) bool {
-	return s.RequestsPercentUsed() > threshold*100 || s.TokensPercentUsed() > threshold*100
-}
 
-// RequestsPercentUsed returns the percentage of requests used (0-100)
-func (s *RateLimitStatus) RequestsPercentUsed() float64 {
-	if s.RequestsLimit == 0 {
-		return 0
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
 	}
-	used := s.RequestsLimit - s.RequestsRemaining
-	return float64(used) / float64(s.RequestsLimit) * 100
-}
+	defer resp.Body.Close()
 
-// TokensPercentUsed returns the percentage of tokens used (0-100)
-func (s *RateLimitStatus) TokensPercentUsed() float64 {
-	if s.TokensLimit == 0 {
-		return 0
+	status, err := checker.ParseStatus(resp)
+	if err != nil {
+		return nil, err
 	}
-	used := s.TokensLimit - s.TokensRemaining
-	return float64(used) / float64(s.TokensLimit) * 100
-}
-
-// PercentUsed returns the higher of requests or tokens percent used
-func (s *RateLimitStatus) PercentUsed() int {
-	reqPercent := s.RequestsPercentUsed()
-	tokPercent := s.TokensPercentUsed()
+	status.Provider = token.Provider.Name
 
-	if reqPercent > tokPercent {
-		return int(reqPercent)
-	}
-	return int(tokPercent)
+	return status, nil
 }
 
-// TimeUntilReset returns how long until the rate limit resets
-func (s *RateLimitStatus) TimeUntilReset() time.Duration {
-	return time.Until(s.ResetTime)
+// parseCohereHeaders extracts trial call limits from Cohere response headers
+func parseCohereHeaders(s *tokens.RateLimitStatus, headers http.Header) {
+	s.RequestsLimit = parseInt(headers.Get("x-trial-endpoint-call-limit"))
+	s.RequestsRemaining = parseInt(headers.Get("x-trial-endpoint-call-remaining"))
 }
 
 // parseInt safely parses a string to int, returning 0 on error
@@ -0,0 +1,84 @@
+package supervisor
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// stubChecker probes a test server and reports a fixed, healthy status
+type stubChecker struct {
+	url string
+}
+
+func (c stubChecker) ProbeRequest(ctx context.Context, token *tokens.Token, model string) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", c.url, nil)
+}
+
+func (c stubChecker) ParseStatus(resp *http.Response) (*tokens.RateLimitStatus, error) {
+	return &tokens.RateLimitStatus{RequestsLimit: 100, RequestsRemaining: 90}, nil
+}
+
+func TestWatchGoroutinesStayFlat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	provider := &tokens.Provider{Name: "Stub", Domain: "stub.test", EnvVars: []string{"STUB_KEY"}}
+	RegisterChecker(provider.Name, stubChecker{url: server.URL})
+
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(provider, []string{"stub-key-1", "stub-key-2"}); err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	opts := DefaultOptions()
+	opts.Interval = time.Millisecond
+	s := New(pool, []string{"true"}, opts)
+
+	// Warm up the HTTP client's connection pool so its goroutines count
+	// in the baseline
+	if err := s.startWatching(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	s.stopWatching()
+	before := settledGoroutines(0)
+
+	for i := 0; i < 200; i++ {
+		if err := s.startWatching(); err != nil {
+			t.Fatal(err)
+		}
+		if i%10 == 0 {
+			time.Sleep(2 * time.Millisecond) // Let some probes run
+		}
+		pool.Next()
+	}
+	s.stopWatching()
+
+	if after := settledGoroutines(before); after > before {
+		t.Errorf("goroutines grew from %d to %d over 200 rotations", before, after)
+	}
+}
+
+// settledGoroutines waits up to a second for the goroutine count to drop
+// to want, returning the last count seen
+func settledGoroutines(want int) int {
+	n := runtime.NumGoroutine()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		if n = runtime.NumGoroutine(); want > 0 && n <= want {
+			break
+		}
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package supervisor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Options configures a Supervisor
+type Options struct {
+	Interactive bool          // Prompt the user when a limit is hit instead of auto-rotating
+	Interval    time.Duration // How often the monitor checks limits
+	Threshold   float64       // Rotate when usage exceeds this fraction (0.95 = 95%)
+	ProbeModel  string        // Model for probes that need one ("" = checker default)
+	Grace       time.Duration // How long to wait after SIGTERM before killing the subprocess
+	Proxy       bool          // Route the child through a local proxy and watch its traffic instead of probing
+	PTY         bool          // Run the child on a pseudo-terminal that ddollar relays, for full-screen TUIs
+	Hooks       Hooks         // Shell commands run on rotation, exhaustion and exit
+	Commands    Commands      // Per-provider launch templates, for failover across providers
+	Restart     RestartPolicy // What to do when the child exits on its own
+
+	// Resume is the command used to restart the child after a rotation,
+	// so it picks up where it left off. "{command}" expands to the
+	// original command line, "{program}" to its first word and "{args}"
+	// to the rest. Nil restarts with the original command.
+	Resume []string
+
+	// ResumePresets uses the built-in resume command of whichever program
+	// is launched, when Resume is nil. With command templates that can
+	// differ per provider.
+	ResumePresets bool
+}
+
+// DefaultOptions returns the settings used when no flags are given
+func DefaultOptions() Options {
+	return Options{
+		Interval:  60 * time.Second,
+		Threshold: 0.95,
+		Grace:     10 * time.Second,
+		Restart: RestartPolicy{
+			Policy:      RestartNever,
+			Backoff:     time.Second,
+			MaxBackoff:  5 * time.Minute,
+			CrashLoop:   5,
+			CrashWindow: time.Minute,
+		},
+	}
+}
+
+// ResumeFor returns the resume command for launching command, or nil if
+// it restarts as it is
+func (o Options) ResumeFor(command []string) []string {
+	if o.Resume == nil && o.ResumePresets {
+		return ResumePreset(command)
+	}
+	return o.Resume
+}
+
+// Validate reports the first nonsensical setting
+func (o Options) Validate() error {
+	if o.Interval < time.Second {
+		return fmt.Errorf("interval must be at least 1s, got %s", o.Interval)
+	}
+	if o.Threshold <= 0 || o.Threshold > 1 {
+		return fmt.Errorf("threshold must be between 0 and 1 (e.g. 0.95), got %g", o.Threshold)
+	}
+	if o.Grace < 0 {
+		return fmt.Errorf("grace must not be negative, got %s", o.Grace)
+	}
+	if err := o.Restart.validate(); err != nil {
+		return err
+	}
+	for name, tmpl := range o.Commands {
+		if len(tmpl.Command) > 0 && tmpl.Command[0] == "{args}" {
+			return fmt.Errorf("command for %s must start with a program or {command}", name)
+		}
+	}
+	return nil
+}
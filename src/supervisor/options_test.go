@@ -0,0 +1,56 @@
+package supervisor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Options)
+		wantErr string // "" = valid
+	}{
+		{"defaults", func(o *Options) {}, ""},
+		{"one second interval", func(o *Options) { o.Interval = time.Second }, ""},
+		{"short interval", func(o *Options) { o.Interval = 999 * time.Millisecond }, "interval"},
+		{"threshold of 1", func(o *Options) { o.Threshold = 1 }, ""},
+		{"tiny threshold", func(o *Options) { o.Threshold = 0.01 }, ""},
+		{"zero threshold", func(o *Options) { o.Threshold = 0 }, "threshold"},
+		{"threshold over 1", func(o *Options) { o.Threshold = 95 }, "threshold"},
+		{"no grace", func(o *Options) { o.Grace = 0 }, ""},
+		{"negative grace", func(o *Options) { o.Grace = -time.Second }, "grace"},
+		{"restart always", func(o *Options) { o.Restart.Policy = RestartAlways }, ""},
+		{"unknown restart policy", func(o *Options) { o.Restart.Policy = "sometimes" }, "restart policy"},
+		{"zero backoff", func(o *Options) { o.Restart.Backoff = 0 }, ""},
+		{"backoff over max", func(o *Options) { o.Restart.Backoff = time.Hour }, "backoff"},
+		{"negative max restarts", func(o *Options) { o.Restart.MaxRestarts = -1 }, "max restarts"},
+		{"negative crash loop", func(o *Options) { o.Restart.CrashLoop = -1 }, "crash loop"},
+		{"command template", func(o *Options) {
+			o.Commands = Commands{"OpenAI": {Command: []string{"codex", "{args}"}}}
+		}, ""},
+		{"env-only template", func(o *Options) {
+			o.Commands = Commands{"Groq": {Env: map[string]string{"MODEL": "llama"}}}
+		}, ""},
+		{"template starting with args", func(o *Options) {
+			o.Commands = Commands{"OpenAI": {Command: []string{"{args}"}}}
+		}, "command for OpenAI"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			tt.modify(&opts)
+			err := opts.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("got error %v, want none", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("got no error, want one mentioning %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("got error %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
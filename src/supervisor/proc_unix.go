@@ -0,0 +1,103 @@
+//go:build !windows
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// forwardedSignals are passed on to the subprocess's process group
+var forwardedSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP,
+	syscall.SIGWINCH, syscall.SIGUSR1, syscall.SIGUSR2,
+}
+
+// resizeSignal tells a process its terminal changed size
+var resizeSignal os.Signal = syscall.SIGWINCH
+
+// controllingTerminal returns stdin's descriptor if it is a terminal whose
+// foreground process group is ours, or -1
+func controllingTerminal() int {
+	fd := int(os.Stdin.Fd())
+	pgid, err := foregroundGroup(fd)
+	if err != nil || pgid != syscall.Getpgrp() {
+		return -1
+	}
+	return fd
+}
+
+// foregroundGroup returns the foreground process group of the terminal fd
+func foregroundGroup(fd int) (int, error) {
+	var pgid int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid))); errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// setForeground makes pgid the terminal's foreground process group
+func setForeground(fd, pgid int) error {
+	// A background group changing the foreground gets SIGTTOU unless it's
+	// ignored. Ignore it only for the call; ignored signals survive exec.
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	id := int32(pgid)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&id))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setProcessGroup starts cmd as the leader of a new process group, so it
+// and everything it spawns can be signalled together. With a terminal the
+// group is put in the foreground, so the command can read it and gets
+// Ctrl-C and window size changes directly.
+func setProcessGroup(cmd *exec.Cmd, tty int) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if tty >= 0 {
+		// Ctty is a descriptor in the child, where the terminal is stdin
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = 0
+	}
+}
+
+// signalGroup sends sig to cmd's process group
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+}
+
+// terminateGroup asks cmd's process group to exit
+func terminateGroup(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGTERM)
+}
+
+// killGroup kills cmd's process group
+func killGroup(cmd *exec.Cmd) error {
+	return signalGroup(cmd, syscall.SIGKILL)
+}
+
+// groupAlive reports whether any process in cmd's process group is left
+func groupAlive(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) == nil
+}
+
+// takeTerminal moves the terminal's foreground back to ddollar
+func takeTerminal(tty int) {
+	if tty >= 0 {
+		setForeground(tty, syscall.Getpgrp())
+	}
+}
+
+// giveTerminal hands the terminal's foreground back to cmd's process
+// group, continuing it in case it stopped reading while in the background
+func giveTerminal(tty int, cmd *exec.Cmd) {
+	if tty >= 0 {
+		setForeground(tty, cmd.Process.Pid)
+		signalGroup(cmd, syscall.SIGCONT)
+	}
+}
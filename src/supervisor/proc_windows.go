@@ -0,0 +1,54 @@
+//go:build windows
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardedSignals are caught so ddollar outlives the subprocess on Ctrl-C.
+// The console already delivers Ctrl-C to every attached process, so
+// nothing needs passing on.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// resizeSignal is nil; Windows has no window size signal
+var resizeSignal os.Signal
+
+// controllingTerminal always returns -1; consoles have no process groups
+func controllingTerminal() int {
+	return -1
+}
+
+// setProcessGroup does nothing on Windows
+func setProcessGroup(cmd *exec.Cmd, tty int) {}
+
+// signalGroup forwards sig to cmd. Windows can only deliver os.Kill to
+// another process, so anything else is dropped.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	if sig == os.Kill {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// terminateGroup kills cmd, which is the only way to stop it on Windows
+func terminateGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// killGroup kills cmd
+func killGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// groupAlive reports false; only cmd itself is tracked on Windows
+func groupAlive(cmd *exec.Cmd) bool {
+	return false
+}
+
+// takeTerminal does nothing on Windows
+func takeTerminal(tty int) {}
+
+// giveTerminal does nothing on Windows
+func giveTerminal(tty int, cmd *exec.Cmd) {}
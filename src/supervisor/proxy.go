@@ -0,0 +1,309 @@
+package supervisor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// proxyKeyPrefix marks the per-run key handed to the child in place of a
+// real token when the proxy injects credentials itself
+const proxyKeyPrefix = "ddollar-proxy-"
+
+// Proxy is a local reverse proxy for one provider. The child is pointed at
+// it through the provider's base URL env var; every upstream response has
+// its rate limit headers parsed and reported, so rotation decisions come
+// from real traffic instead of probes.
+//
+// The proxy injects the pool's current token into every request, so a
+// rotation takes effect on the next request without restarting the child.
+type Proxy struct {
+	pool     *tokens.Pool
+	provider *tokens.Provider
+	upstream *url.URL
+	checker  LimitChecker
+	secret   string
+	listener net.Listener
+	server   *http.Server
+	onStatus func(token string, status *tokens.RateLimitStatus)
+}
+
+// NewProxy creates a proxy for provider that authenticates with the pool's
+// current token and calls onStatus with the token used and the parsed limits
+// of every upstream response
+func NewProxy(pool *tokens.Pool, provider *tokens.Provider, onStatus func(token string, status *tokens.RateLimitStatus)) (*Proxy, error) {
+	if (provider.BaseURL == "" && provider.EndpointEnv == "") || provider.BaseURLEnv == "" {
+		return nil, fmt.Errorf("proxy mode is not supported for %s (no base URL env var)", provider.Name)
+	}
+
+	// Providers with per-token endpoints have no fixed upstream
+	upstream, err := url.Parse(provider.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL for %s: %w", provider.Name, err)
+	}
+
+	checker := CheckerFor(provider)
+	if checker == nil {
+		return nil, fmt.Errorf("no limit checker for provider: %s", provider.Name)
+	}
+
+	// A random key per run, so other local processes can't borrow the
+	// proxy's credentials by guessing a fixed placeholder
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("proxy key: %w", err)
+	}
+
+	p := &Proxy{
+		pool:     pool,
+		provider: provider,
+		upstream: upstream,
+		checker:  checker,
+		secret:   proxyKeyPrefix + hex.EncodeToString(secret),
+		onStatus: onStatus,
+	}
+
+	reverse := &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		ModifyResponse: p.modifyResponse,
+		Transport:      &failoverTransport{proxy: p, base: http.DefaultTransport},
+		FlushInterval:  -1, // Flush immediately so streamed responses stay live
+		ErrorLog:       log.Default(),
+	}
+	p.server = &http.Server{Handler: p.guard(reverse)}
+
+	return p, nil
+}
+
+// Start listens on a random loopback port and serves in the background
+func (p *Proxy) Start() error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("proxy listen: %w", err)
+	}
+	p.listener = listener
+
+	go func() {
+		if err := p.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Proxy: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// URL returns the base URL the child should use
+func (p *Proxy) URL() string {
+	return "http://" + p.listener.Addr().String() + p.provider.BaseURLPath
+}
+
+// Key returns the per-run key the child authenticates to the proxy with
+func (p *Proxy) Key() string {
+	return p.secret
+}
+
+// Env returns the environment entry that points the child at the proxy
+func (p *Proxy) Env() string {
+	return p.provider.BaseURLEnv + "=" + p.URL()
+}
+
+// Close stops the proxy
+func (p *Proxy) Close() error {
+	return p.server.Close()
+}
+
+// guard rejects requests that don't carry the per-run key before they reach
+// the reverse proxy, which can't refuse a request from its Rewrite hook
+func (p *Proxy) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !p.authorized(r) {
+			http.Error(w, "ddollar proxy: missing or invalid key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether a request from the child carries the per-run key
+func (p *Proxy) authorized(r *http.Request) bool {
+	key := p.provider.TokenFromHeader(r.Header.Get(p.provider.AuthHeader))
+	return subtle.ConstantTimeCompare([]byte(key), []byte(p.secret)) == 1
+}
+
+// rewrite sends the child's request to the real provider with the current
+// token; guard has already checked the child's key
+func (p *Proxy) rewrite(r *httputil.ProxyRequest) {
+	r.SetURL(p.upstream)
+
+	if token := p.pool.CurrentTokenFor(p.provider.Domain); token != nil {
+		p.authenticate(r.Out, token)
+	}
+
+	// Let the transport negotiate (and undo) compression so usage can be
+	// read from the body; the hop to the child is loopback anyway
+	r.Out.Header.Del("Accept-Encoding")
+}
+
+// authenticate sets token's credentials on an outgoing request, and for
+// tokens bound to their own endpoint and deployment, points it there
+func (p *Proxy) authenticate(req *http.Request, token *tokens.Token) {
+	req.Header.Set(p.provider.AuthHeader, p.provider.AuthPrefix+token.Value)
+
+	if token.Endpoint != "" {
+		if endpoint, err := url.Parse(token.Endpoint); err == nil {
+			req.URL.Scheme = endpoint.Scheme
+			req.URL.Host = endpoint.Host
+			req.Host = ""
+		}
+	}
+	if token.Deployment != "" {
+		if rest, ok := strings.CutPrefix(req.URL.Path, "/openai/deployments/"); ok {
+			_, tail, _ := strings.Cut(rest, "/")
+			req.URL.Path = "/openai/deployments/" + token.Deployment + "/" + tail
+			req.URL.RawPath = ""
+		}
+	}
+}
+
+// modifyResponse reports the rate limit headers of an upstream response and
+// starts usage accounting on its body
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	token := p.provider.TokenFromHeader(resp.Request.Header.Get(p.provider.AuthHeader))
+
+	if resp.StatusCode < 300 {
+		ledger := p.pool.Ledger()
+		record := func(u tokens.Usage) { ledger.Record(token, u) }
+		if body := newUsageReader(resp.Body, resp.Header.Get("Content-Type"), record); body != nil {
+			resp.Body = body
+		}
+	}
+
+	// Parse headers only: the body belongs to the child
+	status, err := p.checker.ParseStatus(&http.Response{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Request:    resp.Request,
+	})
+	if err != nil || (status.RequestsLimit == 0 && status.TokensLimit == 0) {
+		return nil
+	}
+	status.Provider = p.provider.Name
+	p.pool.RecordStatus(token, status)
+
+	if p.onStatus != nil {
+		p.onStatus(token, status)
+	}
+	return nil
+}
+
+// Status codes that mean "try another token": rate limited, and Anthropic's overloaded
+const (
+	statusTooManyRequests = http.StatusTooManyRequests
+	statusOverloaded      = 529
+)
+
+// Cooldowns used when a 429/529 response has no retry-after header
+const (
+	defaultRateLimitCooldown  = 60 * time.Second
+	defaultOverloadedCooldown = 10 * time.Second
+)
+
+// failoverTransport retries rate limited requests with the next healthy token.
+// A retry only borrows that token: the rate limit is reported like any other
+// status, so the supervisor rotates the pool the usual way, with its event,
+// hook and state save.
+//
+// Retries happen inside RoundTrip, before the reverse proxy has written a
+// single byte to the child, so even streaming requests are safe to replay.
+// Once a response is handed back it is never retried: an overload reported
+// mid-stream (an SSE error event after a 200) reaches the child as-is.
+type failoverTransport struct {
+	proxy *Proxy
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	provider := t.proxy.provider
+
+	// Buffer the body so it can be replayed
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The token the request goes out with; req itself is never modified,
+	// each attempt is a clone authenticated with this token
+	used := provider.TokenFromHeader(req.Header.Get(provider.AuthHeader))
+	var token *tokens.Token
+
+	for {
+		attempt := req.Clone(req.Context())
+		if req.Body != nil {
+			attempt.Body = io.NopCloser(bytes.NewReader(body))
+			attempt.ContentLength = int64(len(body))
+		}
+		if token != nil {
+			t.proxy.authenticate(attempt, token)
+		}
+
+		resp, err := t.base.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != statusTooManyRequests && resp.StatusCode != statusOverloaded {
+			return resp, nil
+		}
+
+		until := time.Now().Add(retryAfter(resp))
+		t.proxy.pool.CoolDown(used, until)
+		if t.proxy.onStatus != nil {
+			t.proxy.onStatus(used, &tokens.RateLimitStatus{
+				RequestsLimit: 1,
+				ResetTime:     until,
+				Provider:      provider.Name,
+			})
+		}
+
+		next := t.proxy.pool.RetryTokenFor(provider.Domain, used)
+		if next == nil {
+			// Every token is cooling down - let the child see the error
+			log.Printf("Proxy: HTTP %d and no other token available", resp.StatusCode)
+			return resp, nil
+		}
+
+		log.Printf("Proxy: HTTP %d, retrying with %s", resp.StatusCode, next.Label())
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		token, used = next, next.Value
+	}
+}
+
+// retryAfter returns how long a 429/529 response asks us to wait
+func retryAfter(resp *http.Response) time.Duration {
+	if d := parseRetryAfter(resp.Header); d > 0 {
+		return d
+	}
+	if resp.StatusCode == statusOverloaded {
+		return defaultOverloadedCooldown
+	}
+	return defaultRateLimitCooldown
+}
@@ -0,0 +1,151 @@
+package supervisor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// newTestProxy starts a proxy for a stub provider in front of upstream
+func newTestProxy(t *testing.T, upstream http.Handler, keys ...string) (*Proxy, *tokens.Pool) {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	provider := &tokens.Provider{
+		Name:       "ProxyStub",
+		Domain:     "proxystub.test",
+		EnvVars:    []string{"PROXYSTUB_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+		BaseURL:    server.URL,
+		BaseURLEnv: "PROXYSTUB_BASE_URL",
+	}
+	RegisterChecker(provider.Name, stubChecker{url: server.URL})
+
+	pool := tokens.NewPool()
+	if err := pool.AddProvider(provider, keys); err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := NewProxy(pool, provider, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proxy.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { proxy.Close() })
+	return proxy, pool
+}
+
+// get sends a request to the proxy with the given bearer key
+func get(t *testing.T, proxy *Proxy, key string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest("GET", proxy.URL()+"/v1/models", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestProxyRequiresKey(t *testing.T) {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Header.Get("Authorization"))
+	})
+	proxy, _ := newTestProxy(t, echo, "real-key")
+
+	for _, key := range []string{"", "wrong", proxyKeyPrefix} {
+		if code, _ := get(t, proxy, key); code != http.StatusUnauthorized {
+			t.Errorf("key %q: got HTTP %d, want 401", key, code)
+		}
+	}
+
+	code, body := get(t, proxy, proxy.Key())
+	if code != http.StatusOK {
+		t.Fatalf("per-run key: got HTTP %d, want 200", code)
+	}
+	if body != "Bearer real-key" {
+		t.Errorf("upstream saw %q, want the pool's token", body)
+	}
+}
+
+func TestFailoverRetriesWithoutTouchingRequest(t *testing.T) {
+	limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer key-1" {
+			w.Header().Set("retry-after", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, r.Header.Get("Authorization"))
+	})
+	proxy, pool := newTestProxy(t, limited, "key-1", "key-2")
+	transport := &failoverTransport{proxy: proxy, base: http.DefaultTransport}
+
+	req, err := http.NewRequest("POST", proxy.upstream.String()+"/v1/chat", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer key-1")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || string(body) != "Bearer key-2" {
+		t.Errorf("got HTTP %d %q, want a retry with key-2", resp.StatusCode, body)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer key-1" {
+		t.Errorf("caller's request was modified: Authorization = %q", got)
+	}
+	if until := pool.CoolingUntil("key-1"); time.Until(until) < 20*time.Second {
+		t.Errorf("key-1 cooling until %v, want about 30s from retry-after", until)
+	}
+}
+
+func TestFailoverRetryLeavesRotationToTheSupervisor(t *testing.T) {
+	limited := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer key-1" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, r.Header.Get("Authorization"))
+	})
+	proxy, pool := newTestProxy(t, limited, "key-1", "key-2", "key-3")
+	var reported []string
+	proxy.onStatus = func(token string, status *tokens.RateLimitStatus) {
+		if status.Exhausted() {
+			reported = append(reported, token)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, body := get(t, proxy, proxy.Key()); code != http.StatusOK || body != "Bearer key-2" {
+			t.Fatalf("request %d: got HTTP %d %q, want a retry with key-2", i, code, body)
+		}
+	}
+
+	// The pool stays put until the supervisor rotates it
+	if got := pool.CurrentToken().Value; got != "key-1" {
+		t.Errorf("a retry moved the cursor to %s", got)
+	}
+	if len(reported) == 0 || reported[0] != "key-1" {
+		t.Errorf("reported exhaustion of %v, want key-1", reported)
+	}
+}
@@ -0,0 +1,254 @@
+package supervisor
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// ptyDrainTimeout bounds how long a stopped subprocess's last output is
+// waited for, in case something it started still holds the PTY open
+const ptyDrainTimeout = 500 * time.Millisecond
+
+// resetSequence puts a terminal back in a sane state after a full-screen
+// program is killed mid-draw: main screen, normal cursor keys and keypad,
+// visible cursor, default colours, no mouse tracking or bracketed paste
+const resetSequence = "\x1b[?1047l\x1b[?1l\x1b>\x1b[?25h\x1b[0m" +
+	"\x1b[?1000l\x1b[?1002l\x1b[?1003l\x1b[?1006l\x1b[?2004l\r\n"
+
+// control runs fn with f's descriptor. Unlike f.Fd, it leaves f
+// non-blocking, so a pending Read still returns when f is closed.
+func control(f *os.File, fn func(fd uintptr) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) { fnErr = fn(fd) }); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// console runs the subprocess on a pseudo-terminal in PTY mode. ddollar
+// keeps the real terminal in raw mode and copies between the two, which
+// lets it resize the child's terminal, reset the real one between
+// restarts, and take the keyboard for its own prompts.
+type console struct {
+	in    *os.File
+	saved *termState // Real terminal settings to restore, nil if stdin isn't a terminal
+
+	mu        sync.Mutex
+	master    *os.File // Current subprocess's PTY, nil between restarts
+	prompting bool     // Keystrokes go to keys instead of the PTY
+
+	keys   chan []byte // Keystrokes read while prompting; closed at EOF
+	output sync.Mutex  // Held while prompting, pausing the subprocess's output
+}
+
+// newConsole puts the real terminal in raw mode and starts reading it
+func newConsole() (*console, error) {
+	c := &console{in: os.Stdin, keys: make(chan []byte, 16)}
+	if isTerminal(c.in.Fd()) {
+		saved, err := makeRaw(c.in.Fd())
+		if err != nil {
+			return nil, err
+		}
+		c.saved = saved
+	}
+	go c.pumpInput()
+	return c, nil
+}
+
+// Close restores the real terminal's settings
+func (c *console) Close() error {
+	if c.saved == nil {
+		return nil
+	}
+	return restoreTerminal(c.in.Fd(), c.saved)
+}
+
+// pumpInput copies keystrokes to the subprocess, or to a prompt
+func (c *console) pumpInput() {
+	defer close(c.keys)
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := c.in.Read(buf)
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		prompting, master := c.prompting, c.master
+		c.mu.Unlock()
+
+		switch {
+		case prompting:
+			select {
+			case c.keys <- append([]byte(nil), buf[:n]...):
+			default:
+				// Nobody is keeping up; drop the keystrokes
+			}
+		case master != nil:
+			master.Write(buf[:n])
+		}
+	}
+}
+
+// ptySession is one subprocess's PTY
+type ptySession struct {
+	console *console
+	master  *os.File
+	slave   *os.File
+	drained chan struct{} // Closed once the subprocess's output is copied
+}
+
+// attach opens a PTY and makes it cmd's stdin, stdout, stderr and
+// controlling terminal
+func (c *console) attach(cmd *exec.Cmd) (*ptySession, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	if c.saved != nil {
+		c.copyWinsize(master)
+	}
+
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	setControllingTerminal(cmd)
+
+	p := &ptySession{console: c, master: master, slave: slave, drained: make(chan struct{})}
+	c.mu.Lock()
+	c.master = master
+	c.mu.Unlock()
+	go p.pumpOutput()
+	return p, nil
+}
+
+// pumpOutput copies the subprocess's output to the real terminal. Reads
+// fail once every copy of the PTY's other end is closed.
+func (p *ptySession) pumpOutput() {
+	defer close(p.drained)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := p.master.Read(buf)
+		if n > 0 {
+			p.console.output.Lock()
+			os.Stdout.Write(buf[:n])
+			p.console.output.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// started closes ddollar's copy of the subprocess's end of the PTY, once
+// the subprocess has its own
+func (p *ptySession) started() {
+	p.slave.Close()
+}
+
+// detach waits for the exited subprocess's last output, closes the PTY and
+// resets the real terminal for whatever comes next
+func (p *ptySession) detach() {
+	select {
+	case <-p.drained:
+	case <-time.After(ptyDrainTimeout):
+	}
+
+	c := p.console
+	c.mu.Lock()
+	if c.master == p.master {
+		c.master = nil
+	}
+	c.mu.Unlock()
+	p.master.Close()
+
+	if c.saved != nil {
+		c.output.Lock()
+		io.WriteString(os.Stdout, resetSequence)
+		c.output.Unlock()
+	}
+}
+
+// resize copies the real terminal's size to the subprocess's PTY, which
+// sends the subprocess SIGWINCH
+func (c *console) resize() {
+	c.mu.Lock()
+	master := c.master
+	c.mu.Unlock()
+	if c.saved != nil && master != nil {
+		c.copyWinsize(master)
+	}
+}
+
+// copyWinsize sets the size of master's terminal to the real terminal's
+func (c *console) copyWinsize(master *os.File) {
+	control(master, func(fd uintptr) error {
+		return copyWinsize(c.in.Fd(), fd)
+	})
+}
+
+// readLine reads a line typed at a ddollar prompt, pausing the
+// subprocess's output and keeping keystrokes from it meanwhile. Ctrl-C or
+// Ctrl-D gives up with io.EOF.
+func (c *console) readLine() (string, error) {
+	c.output.Lock()
+	defer c.output.Unlock()
+
+	// Drop anything typed before the prompt appeared
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-c.keys:
+			if !ok {
+				return "", io.EOF
+			}
+		default:
+			drained = true
+		}
+	}
+
+	c.mu.Lock()
+	c.prompting = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.prompting = false
+		c.mu.Unlock()
+	}()
+
+	// In raw mode nothing is echoed or line-edited for us
+	echo := func(s string) {
+		if c.saved != nil {
+			io.WriteString(os.Stdout, s)
+		}
+	}
+
+	var line []byte
+	for chunk := range c.keys {
+		for _, b := range chunk {
+			switch {
+			case b == '\r' || b == '\n':
+				echo("\r\n")
+				return string(line), nil
+			case b == 0x7f || b == '\b':
+				if len(line) > 0 {
+					line = line[:len(line)-1]
+					echo("\b \b")
+				}
+			case b == 0x03 || b == 0x04:
+				echo("\r\n")
+				return "", io.EOF
+			case b >= 0x20:
+				line = append(line, b)
+				echo(string(b))
+			}
+		}
+	}
+	return "", io.EOF
+}
@@ -0,0 +1,41 @@
+//go:build !linux && !darwin
+
+package supervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// termState is unused where PTY mode isn't supported
+type termState struct{}
+
+// openPTY reports that PTY mode isn't available on this platform
+func openPTY() (master, slave *os.File, err error) {
+	return nil, nil, fmt.Errorf("PTY mode is not supported on %s", runtime.GOOS)
+}
+
+// isTerminal reports false; PTY mode is unsupported here
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+// makeRaw is never called, as isTerminal is always false
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, fmt.Errorf("PTY mode is not supported on %s", runtime.GOOS)
+}
+
+// restoreTerminal does nothing
+func restoreTerminal(fd uintptr, state *termState) error {
+	return nil
+}
+
+// copyWinsize does nothing
+func copyWinsize(from, to uintptr) error {
+	return nil
+}
+
+// setControllingTerminal does nothing
+func setControllingTerminal(cmd *exec.Cmd) {}
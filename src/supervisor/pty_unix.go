@@ -0,0 +1,83 @@
+//go:build linux || darwin
+
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// termState is a terminal's saved settings
+type termState struct {
+	termios syscall.Termios
+}
+
+// winsize is struct winsize from <sys/ioctl.h>
+type winsize struct {
+	Row, Col, Xpixel, Ypixel uint16
+}
+
+// ioctl calls ioctl(2) with a pointer argument
+func ioctl(fd uintptr, req uint, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// fileIoctl calls ioctl(2) on f without putting it in blocking mode
+func fileIoctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	return control(f, func(fd uintptr) error { return ioctl(fd, req, arg) })
+}
+
+// isTerminal reports whether fd is a terminal
+func isTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&t)) == nil
+}
+
+// makeRaw switches the terminal fd to raw input and returns its previous
+// settings. Output processing is left on so ddollar's own messages still
+// get carriage returns.
+func makeRaw(fd uintptr) (*termState, error) {
+	var saved termState
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&saved.termios)); err != nil {
+		return nil, err
+	}
+
+	raw := saved.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// restoreTerminal puts back settings saved by makeRaw
+func restoreTerminal(fd uintptr, state *termState) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&state.termios))
+}
+
+// copyWinsize sets the size of terminal to to that of terminal from
+func copyWinsize(from, to uintptr) error {
+	var ws winsize
+	if err := ioctl(from, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return err
+	}
+	return ioctl(to, syscall.TIOCSWINSZ, unsafe.Pointer(&ws))
+}
+
+// setControllingTerminal starts cmd in a new session with its stdin, the
+// PTY, as the controlling terminal. The session leader also leads a new
+// process group, so signalGroup still reaches everything it starts.
+func setControllingTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
@@ -0,0 +1,173 @@
+package supervisor
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Restart policies for a command that exits on its own
+const (
+	RestartNever     = "never"      // Supervision ends with the command (default)
+	RestartOnFailure = "on-failure" // Restart unless it exits with code 0
+	RestartAlways    = "always"     // Restart whatever the exit status
+)
+
+// RestartPolicy says whether and how to restart a command that exits on
+// its own. Exits ddollar causes, like rotations, are always restarted.
+type RestartPolicy struct {
+	Policy      string        // RestartNever, RestartOnFailure or RestartAlways
+	MaxRestarts int           // Give up after this many restarts (0 = no limit)
+	Backoff     time.Duration // Wait before the first restart, doubling each time
+	MaxBackoff  time.Duration // Longest wait between restarts
+	CrashLoop   int           // Give up if the command exits this many times...
+	CrashWindow time.Duration // ...within this long (0 = never)
+}
+
+// validate reports the first nonsensical setting
+func (p RestartPolicy) validate() error {
+	switch p.Policy {
+	case RestartNever, RestartOnFailure, RestartAlways:
+	default:
+		return fmt.Errorf("restart policy must be %s, %s or %s, got %q", RestartNever, RestartOnFailure, RestartAlways, p.Policy)
+	}
+	if p.MaxRestarts < 0 {
+		return fmt.Errorf("max restarts must not be negative, got %d", p.MaxRestarts)
+	}
+	if p.Backoff < 0 || p.MaxBackoff < p.Backoff {
+		return fmt.Errorf("restart backoff must be between 0 and the max backoff (%s), got %s", p.MaxBackoff, p.Backoff)
+	}
+	if p.CrashLoop < 0 || p.CrashWindow < 0 {
+		return fmt.Errorf("crash loop detection must not be negative, got %d in %s", p.CrashLoop, p.CrashWindow)
+	}
+	return nil
+}
+
+// restarter tracks a command's exits to decide on restarts
+type restarter struct {
+	policy   RestartPolicy
+	restarts int         // Restarts so far
+	failures int         // Consecutive short-lived runs, for backoff
+	exits    []time.Time // Recent exits, for crash loop detection
+}
+
+// decide returns how long to wait before restarting a command that exited
+// with code after running for ran, and why. A zero reason with ok false
+// means the policy doesn't restart it; a non-empty one says why ddollar
+// gave up.
+func (r *restarter) decide(code int, ran time.Duration) (wait time.Duration, reason string, ok bool) {
+	p := r.policy
+	if p.Policy == RestartNever || (p.Policy == RestartOnFailure && code == 0) {
+		return 0, "", false
+	}
+
+	now := time.Now()
+	if p.CrashLoop > 0 && p.CrashWindow > 0 {
+		recent := r.exits[:0]
+		for _, t := range r.exits {
+			if now.Sub(t) < p.CrashWindow {
+				recent = append(recent, t)
+			}
+		}
+		r.exits = append(recent, now)
+		if len(r.exits) >= p.CrashLoop {
+			return 0, fmt.Sprintf("crash loop: %d exits within %s", len(r.exits), p.CrashWindow), false
+		}
+	}
+	if p.MaxRestarts > 0 && r.restarts >= p.MaxRestarts {
+		return 0, fmt.Sprintf("reached max restarts (%d)", p.MaxRestarts), false
+	}
+
+	// A run that outlasted the longest backoff wasn't a crash loop, so
+	// start again from the shortest wait
+	if ran >= p.MaxBackoff {
+		r.failures = 0
+	}
+	// Compare before shifting, so long runs of failures can't overflow. A
+	// zero backoff restarts immediately every time.
+	if n := min(r.failures, 62); p.Backoff > p.MaxBackoff>>n {
+		wait = p.MaxBackoff
+	} else {
+		wait = p.Backoff << n
+	}
+	// Equal jitter: at least half the wait, so restarts of several
+	// ddollars don't line up
+	if wait > 0 {
+		wait = wait/2 + rand.N(wait/2+1)
+	}
+
+	r.failures++
+	r.restarts++
+	reason = fmt.Sprintf("restart %d", r.restarts)
+	if p.MaxRestarts > 0 {
+		reason += fmt.Sprintf("/%d", p.MaxRestarts)
+	}
+	return wait, reason, true
+}
+
+// terminates reports whether sig asks the command to exit
+func terminates(sig os.Signal) bool {
+	return sig == os.Interrupt || sig == syscall.SIGTERM || sig == syscall.SIGHUP
+}
+
+// restart restarts the command after it exited with err, if the restart
+// policy says to, waiting out the backoff first. An exit that follows a
+// termination signal is never restarted, and one during the wait cancels
+// the restart. Reports whether it restarted.
+func (s *Supervisor) restart(err error, signals <-chan os.Signal) bool {
+	if s.stoppedBy != nil {
+		if s.restarter.policy.Policy != RestartNever {
+			fmt.Printf("\n✗ Not restarting: stopped by %v\n", s.stoppedBy)
+			s.logEvent(eventGiveUp, "stopped by %v", s.stoppedBy)
+		}
+		return false
+	}
+
+	wait, reason, ok := s.restarter.decide(exitCode(err), time.Since(s.launched))
+	if !ok {
+		if reason != "" {
+			fmt.Printf("\n✗ Not restarting: %s\n", reason)
+			s.logEvent(eventGiveUp, "%s", reason)
+		}
+		return false
+	}
+
+	// Backoffs start well under a second, too short for formatDuration
+	backoff := wait.Round(time.Millisecond).String()
+	if wait >= time.Minute {
+		backoff = formatDuration(wait)
+	}
+	fmt.Printf("\n⚠️  Process %s\n", describeExit(err))
+	fmt.Printf("▶  Restarting in %s (%s)...\n", backoff, reason)
+
+	s.stopWatching()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for waiting := true; waiting; {
+		select {
+		case <-timer.C:
+			waiting = false
+		case sig := <-signals:
+			// Other signals have nobody to go to until the restart
+			if terminates(sig) {
+				fmt.Printf("✗ Restart cancelled by %v\n", sig)
+				s.logEvent(eventGiveUp, "restart cancelled by %v", sig)
+				return false
+			}
+		}
+	}
+
+	s.logEvent(eventRestart, "%s after it %s (backoff %s)", reason, describeExit(err), backoff)
+	if err := s.startSubprocess(false); err != nil {
+		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
+		s.exit(1)
+	}
+	if err := s.startWatching(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		s.exit(1)
+	}
+	fmt.Print("✓ Session resumed\n\n")
+	return true
+}
@@ -0,0 +1,132 @@
+package supervisor
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRestarterDecide(t *testing.T) {
+	policy := func(name string) RestartPolicy {
+		return RestartPolicy{Policy: name, Backoff: time.Second, MaxBackoff: time.Minute}
+	}
+	ago := func(d time.Duration) time.Time { return time.Now().Add(-d) }
+
+	tests := []struct {
+		name     string
+		policy   RestartPolicy
+		failures int
+		restarts int
+		exits    []time.Time
+		code     int
+		ran      time.Duration
+
+		wait       time.Duration // Before jitter; the result is within [wait/2, wait]
+		reason     string        // Contained in the reason
+		ok         bool
+		exitsAfter int // Exits remembered for crash loop detection
+	}{
+		{name: "never", policy: policy(RestartNever), code: 1},
+		{name: "on-failure skips exit 0", policy: policy(RestartOnFailure), code: 0},
+		{name: "on-failure restarts a failure", policy: policy(RestartOnFailure), code: 1, wait: time.Second, reason: "restart 1", ok: true},
+		{name: "always restarts exit 0", policy: policy(RestartAlways), code: 0, wait: time.Second, reason: "restart 1", ok: true},
+		{name: "backoff doubles", policy: policy(RestartAlways), failures: 2, restarts: 2, wait: 4 * time.Second, reason: "restart 3", ok: true},
+		{name: "backoff is capped", policy: policy(RestartAlways), failures: 10, wait: time.Minute, ok: true},
+		{name: "many failures don't overflow", policy: policy(RestartAlways), failures: 100, wait: time.Minute, ok: true},
+		{
+			name:   "zero backoff restarts immediately",
+			policy: RestartPolicy{Policy: RestartAlways, MaxBackoff: time.Minute}, failures: 5,
+			wait: 0, ok: true,
+		},
+		{name: "a long run resets the backoff", policy: policy(RestartAlways), failures: 5, ran: time.Minute, wait: time.Second, ok: true},
+		{
+			name:   "max restarts",
+			policy: RestartPolicy{Policy: RestartAlways, MaxRestarts: 3, Backoff: time.Second, MaxBackoff: time.Minute}, restarts: 3,
+			reason: "reached max restarts (3)",
+		},
+		{
+			name:   "below max restarts",
+			policy: RestartPolicy{Policy: RestartAlways, MaxRestarts: 3, Backoff: time.Second, MaxBackoff: time.Minute}, restarts: 2,
+			wait: time.Second, reason: "restart 3/3", ok: true,
+		},
+		{
+			name:   "crash loop",
+			policy: RestartPolicy{Policy: RestartAlways, Backoff: time.Second, MaxBackoff: time.Minute, CrashLoop: 3, CrashWindow: time.Minute},
+			exits:  []time.Time{ago(10 * time.Second), ago(5 * time.Second)},
+			reason: "crash loop: 3 exits within 1m0s", exitsAfter: 3,
+		},
+		{
+			name:   "old exits leave the crash loop window",
+			policy: RestartPolicy{Policy: RestartAlways, Backoff: time.Second, MaxBackoff: time.Minute, CrashLoop: 3, CrashWindow: time.Minute},
+			exits:  []time.Time{ago(2 * time.Minute), ago(90 * time.Second), ago(5 * time.Second)},
+			wait:   time.Second, ok: true, exitsAfter: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &restarter{policy: tt.policy, failures: tt.failures, restarts: tt.restarts, exits: tt.exits}
+			wait, reason, ok := r.decide(tt.code, tt.ran)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v (%q), want %v", ok, reason, tt.ok)
+			}
+			if wait < tt.wait/2 || wait > tt.wait {
+				t.Errorf("wait %v, want between %v and %v", wait, tt.wait/2, tt.wait)
+			}
+			if tt.reason == "" && !ok && reason != "" {
+				t.Errorf("reason %q, want none", reason)
+			}
+			if !strings.Contains(reason, tt.reason) {
+				t.Errorf("reason %q, want it to contain %q", reason, tt.reason)
+			}
+			if len(r.exits) != tt.exitsAfter {
+				t.Errorf("remembers %d exits, want %d", len(r.exits), tt.exitsAfter)
+			}
+		})
+	}
+}
+
+func TestRestarterJitter(t *testing.T) {
+	r := &restarter{policy: RestartPolicy{Policy: RestartAlways, Backoff: time.Second, MaxBackoff: 8 * time.Second}}
+	low, high := false, false
+	for i := 0; i < 1000; i++ {
+		r.failures = 3 // 8s before jitter
+		wait, _, _ := r.decide(1, 0)
+		if wait < 4*time.Second || wait > 8*time.Second {
+			t.Fatalf("wait %v, want between 4s and 8s", wait)
+		}
+		low = low || wait < 5*time.Second
+		high = high || wait > 7*time.Second
+	}
+	if !low || !high {
+		t.Error("jitter did not spread waits across the range")
+	}
+}
+
+func TestNoRestartAfterForwardedTermination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no process groups")
+	}
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd, -1)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Supervisor{
+		subprocess: cmd,
+		restarter:  &restarter{policy: RestartPolicy{Policy: RestartAlways, MaxBackoff: time.Minute}},
+	}
+	s.forward(syscall.SIGTERM)
+	err := cmd.Wait()
+
+	if s.restart(err, nil) {
+		t.Fatal("restarted a command the user stopped")
+	}
+	if last := s.events[len(s.events)-1]; last.Kind != eventGiveUp || !strings.Contains(last.Detail, "terminated") {
+		t.Errorf("logged %+v, want a give up for SIGTERM", last)
+	}
+}
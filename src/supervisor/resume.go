@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ResumePresets are the resume commands of AI CLIs that can pick up their
+// last session, by program name. See Options.Resume for the placeholders.
+var ResumePresets = map[string][]string{
+	"claude": {"{command}", "--continue"},
+	"aider":  {"{command}", "--restore-chat-history"},
+	"codex":  {"{program}", "resume", "--last"},
+	"goose":  {"{command}", "--resume"},
+}
+
+// ResumePreset returns the resume command preset for command's program,
+// or nil if there is none
+func ResumePreset(command []string) []string {
+	if len(command) == 0 {
+		return nil
+	}
+	program := strings.TrimSuffix(filepath.Base(command[0]), ".exe")
+	return ResumePresets[program]
+}
+
+// ResumeArgs returns the resume command that adds args to the original
+func ResumeArgs(args string) []string {
+	return append([]string{"{command}"}, strings.Fields(args)...)
+}
+
+// expandResume returns the command to restart with after a rotation: the
+// resume template filled in with the original command. A command that
+// already has every argument the template adds, like a `claude --continue`
+// typed by hand, is used as it is.
+func expandResume(template, command []string) []string {
+	if len(template) == 0 {
+		return command
+	}
+
+	resumes := true
+	for _, arg := range template {
+		if !isResumePlaceholder(arg) && !slices.Contains(command[1:], arg) {
+			resumes = false
+		}
+	}
+	if resumes {
+		return command
+	}
+
+	var expanded []string
+	for _, arg := range template {
+		switch arg {
+		case "{command}":
+			expanded = append(expanded, command...)
+		case "{program}":
+			expanded = append(expanded, command[0])
+		case "{args}":
+			expanded = append(expanded, command[1:]...)
+		default:
+			expanded = append(expanded, arg)
+		}
+	}
+	return expanded
+}
+
+// isResumePlaceholder reports whether arg expands to part of the original
+// command
+func isResumePlaceholder(arg string) bool {
+	return arg == "{command}" || arg == "{program}" || arg == "{args}"
+}
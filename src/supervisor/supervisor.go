@@ -2,12 +2,13 @@ package supervisor
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/drawohara/ddollar/src/tokens"
@@ -18,19 +19,41 @@ type Supervisor struct {
 	pool        *tokens.Pool
 	monitor     *Monitor
 	command     []string
+	opts        Options
 	interactive bool
 	subprocess  *exec.Cmd
-	statusChan  chan *RateLimitStatus
+	exited      chan error // receives the current subprocess's Wait result
+	tty         int        // Terminal the subprocess is put in the foreground of, or -1
+	console     *console   // Runs the subprocess on a PTY, nil unless PTY mode is enabled
+	statusChan  chan *tokens.RateLimitStatus
+	stopWatch   context.CancelFunc
+	proxy       *Proxy           // nil unless proxy mode is enabled
+	events      []event          // What happened to the command, for the final summary
+	launched    time.Time        // When the current subprocess started
+	restarter   *restarter       // Decides whether to restart after the command exits
+	signals     <-chan os.Signal // Signals caught for the command, set by Run
+	stoppedBy   os.Signal        // Termination signal passed on to the command, if any
+
+	// While running on the local fallback server
+	cloud      string           // Domain of the provider to switch back to
+	switchBack <-chan time.Time // Fires when the cloud provider's limits reset
 }
 
 // New creates a new supervisor for the given command
-func New(pool *tokens.Pool, command []string, interactive bool) *Supervisor {
+func New(pool *tokens.Pool, command []string, opts Options) *Supervisor {
+	monitor := NewMonitor(opts.Interval, opts.Threshold)
+	monitor.probeModel = opts.ProbeModel
+	monitor.SetPool(pool)
+
 	return &Supervisor{
 		pool:        pool,
 		command:     command,
-		interactive: interactive,
-		monitor:     NewMonitor(60*time.Second, 0.95), // Check every 60s, rotate at 95%
-		statusChan:  make(chan *RateLimitStatus),
+		opts:        opts,
+		interactive: opts.Interactive,
+		tty:         -1,
+		restarter:   &restarter{policy: opts.Restart},
+		monitor:     monitor,
+		statusChan:  make(chan *tokens.RateLimitStatus),
 	}
 }
 
@@ -40,28 +63,64 @@ func (s *Supervisor) Run() error {
 
 	fmt.Println("Starting supervision mode...")
 	fmt.Printf("✓ Loaded %d token(s) across %d provider(s)\n", s.pool.TotalTokenCount(), s.pool.ProviderCount())
-	fmt.Println("✓ Monitor started (checking limits every 60s)")
+	if active := s.pool.Active(); active != nil {
+		fmt.Printf("✓ Supervising %s (%d token(s), %s rotation)\n", active.Name, s.pool.ActiveTokenCount(), s.pool.Strategy().Name())
+		if current := s.pool.CurrentToken(); current != nil {
+			fmt.Printf("✓ Starting on token %d/%d (%s)\n", s.pool.CurrentIndex()+1, s.pool.ActiveTokenCount(), current.Label())
+		}
+	}
+	if s.opts.Proxy {
+		if err := s.startProxy(); err != nil {
+			return err
+		}
+		defer s.proxy.Close()
+		fmt.Printf("✓ Proxy started (%s, rotating above %g%%)\n", s.proxy.Env(), s.opts.Threshold*100)
+	} else {
+		fmt.Printf("✓ Monitor started (checking limits every %s, rotating above %g%%)\n", s.opts.Interval, s.opts.Threshold*100)
+	}
+	if template := s.opts.ResumeFor(s.command); len(template) > 0 {
+		resumed := expandResume(template, s.command)
+		fmt.Printf("✓ Restarts after rotation resume with: %s\n", strings.Join(resumed, " "))
+	}
+	if s.opts.PTY {
+		fmt.Println("✓ PTY mode (the command gets its own terminal; ddollar relays it)")
+	}
+	if chain := s.pool.Failover(); len(chain) > 1 {
+		fmt.Printf("✓ Failover: %s\n", strings.Join(chain, " → "))
+	}
+	if local := s.pool.LocalFallback(); local != nil && !s.pool.Active().Local {
+		fmt.Printf("✓ Falling back to %s once all tokens are exhausted\n", local.BaseURL)
+	}
 
-	// Start subprocess with first token
-	if err := s.startSubprocess(); err != nil {
-		return err
+	// Signals meant for the command are passed on to its whole process
+	// group rather than ending ddollar and orphaning it
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+	s.signals = signals
+	if s.opts.PTY {
+		console, err := newConsole()
+		if err != nil {
+			return fmt.Errorf("PTY mode: %w", err)
+		}
+		s.console = console
+		defer console.Close()
+	} else {
+		s.tty = controllingTerminal()
 	}
 
-	// Get current token and start monitoring
-	currentToken := s.pool.CurrentToken()
-	if currentToken == nil {
-		return fmt.Errorf("no token available")
+	// Start subprocess with first token
+	if err := s.startSubprocess(false); err != nil {
+		return err
 	}
 
 	// Start monitor in background
-	go s.monitor.Watch(currentToken, s.statusChan)
+	if err := s.startWatching(); err != nil {
+		return err
+	}
+	defer s.stopWatching()
 
 	// Wait for limit events and subprocess completion
-	subprocessDone := make(chan error)
-	go func() {
-		subprocessDone <- s.subprocess.Wait()
-	}()
-
 	for {
 		select {
 		case status := <-s.statusChan:
@@ -69,16 +128,37 @@ func (s *Supervisor) Run() error {
 			s.handleRotation(status)
 
 			// Restart monitoring with new token
-			currentToken = s.pool.CurrentToken()
-			if currentToken != nil {
-				go s.monitor.Watch(currentToken, s.statusChan)
+			if err := s.startWatching(); err != nil {
+				return err
 			}
 
-		case err := <-subprocessDone:
+		case sig := <-signals:
+			s.forward(sig)
+
+		case <-s.switchBack:
+			s.switchBackToCloud()
+			if err := s.startWatching(); err != nil {
+				return err
+			}
+
+		case err := <-s.exited:
 			// Subprocess finished
+			takeTerminal(s.tty)
+			s.logEvent(eventExit, "%s", describeExit(err))
+			if s.restart(err, signals) {
+				continue
+			}
+			s.printUsageSummary()
+			s.printEventLog()
+			code := exitCode(err)
+			s.runHook("exit", s.opts.Hooks.OnExit, fmt.Sprintf("DDOLLAR_EXIT_CODE=%d", code))
+			if err := s.pool.SaveState(); err != nil {
+				log.Printf("Warning: failed to save pool state: %v", err)
+			}
+			s.pool.ReleaseLeases()
 			if err != nil {
-				fmt.Printf("\n✗ Process exited with error: %v\n", err)
-				return err
+				fmt.Printf("\n✗ Process %s\n", describeExit(err))
+				return &ExitError{Code: code, Err: err}
 			}
 			fmt.Println("\n✓ Process completed successfully")
 			return nil
@@ -86,35 +166,217 @@ func (s *Supervisor) Run() error {
 	}
 }
 
-// startSubprocess launches the command with the current token in ENV
-func (s *Supervisor) startSubprocess() error {
+// launchCommand returns the command line and extra environment to launch
+// against provider. The resume form is that of the program the provider's
+// template launches, which may not be the one typed.
+func (s *Supervisor) launchCommand(provider *tokens.Provider, key, baseURL string, resume bool) ([]string, []string) {
+	command, env := s.opts.Commands.expand(provider, s.command, key, baseURL)
+	if resume {
+		command = expandResume(s.opts.ResumeFor(command), command)
+	}
+	return command, env
+}
+
+// forward passes a caught signal on to the command's process group
+func (s *Supervisor) forward(sig os.Signal) {
+	if sig == resizeSignal && s.console != nil {
+		// The PTY signals the subprocess when its size changes
+		s.console.resize()
+		return
+	}
+	if terminates(sig) {
+		s.stoppedBy = sig
+	}
+	if err := signalGroup(s.subprocess, sig); err != nil {
+		log.Printf("Error forwarding %v: %v", sig, err)
+	}
+}
+
+// pause waits out wait while the command keeps running, forwarding the
+// signals caught meanwhile. A termination signal is forwarded too and ends
+// the wait early, leaving the main loop to see the command exit. Reports
+// whether the whole wait passed.
+func (s *Supervisor) pause(wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case sig := <-s.signals:
+			s.forward(sig)
+			if terminates(sig) {
+				fmt.Printf("✗ Wait cancelled by %v\n", sig)
+				return false
+			}
+		}
+	}
+}
+
+// startSubprocess launches the command with the current token in ENV.
+// resume launches the resume form instead, for restarts after rotation.
+func (s *Supervisor) startSubprocess(resume bool) error {
 	currentToken := s.pool.CurrentToken()
 	if currentToken == nil {
 		return fmt.Errorf("no token available")
 	}
 
-	fmt.Printf("▶  Launching: %s\n\n", strings.Join(s.command, " "))
+	// Set environment with current token. In proxy mode the proxy injects
+	// the real token, so the child only ever sees a placeholder.
+	env := os.Environ()
+	provider := currentToken.Provider
+	tokenEnvVar := provider.EnvVars[0] // Use first env var name
+	key, baseURL := currentToken.Value, provider.BaseURL
+	if currentToken.Endpoint != "" && provider.EndpointEnv != "" {
+		env = append(env, provider.EndpointEnv+"="+currentToken.Endpoint)
+		baseURL = currentToken.Endpoint
+	}
+	if currentToken.Deployment != "" && provider.DeploymentEnv != "" {
+		env = append(env, provider.DeploymentEnv+"="+currentToken.Deployment)
+	}
+	switch {
+	case s.proxied(currentToken):
+		// Later entries win, so the proxy's base URL replaces any endpoint
+		key, baseURL = s.proxy.Key(), s.proxy.URL()
+		env = append(env, fmt.Sprintf("%s=%s", tokenEnvVar, key), s.proxy.Env())
+	case provider.Local:
+		key = tokens.LocalPlaceholderKey
+		env = append(env, fmt.Sprintf("%s=%s", tokenEnvVar, key), provider.BaseURLEnv+"="+baseURL)
+	default:
+		env = append(env, fmt.Sprintf("%s=%s", tokenEnvVar, key))
+	}
 
-	s.subprocess = exec.Command(s.command[0], s.command[1:]...)
+	command, templateEnv := s.launchCommand(provider, key, baseURL, resume)
+	env = append(env, templateEnv...)
 
-	// Set environment with current token
-	env := os.Environ()
-	tokenEnvVar := currentToken.Provider.EnvVars[0] // Use first env var name
-	env = append(env, fmt.Sprintf("%s=%s", tokenEnvVar, currentToken.Value))
+	// A template may put the token on the command line; don't echo it
+	fmt.Printf("▶  Launching: %s\n\n", strings.ReplaceAll(strings.Join(command, " "), key, tokens.MaskToken(key)))
+
+	s.subprocess = exec.Command(command[0], command[1:]...)
 	s.subprocess.Env = env
 
-	// Connect stdio
-	s.subprocess.Stdin = os.Stdin
-	s.subprocess.Stdout = os.Stdout
-	s.subprocess.Stderr = os.Stderr
+	// Connect stdio, directly or through a PTY
+	var pty *ptySession
+	if s.console != nil {
+		var err error
+		if pty, err = s.console.attach(s.subprocess); err != nil {
+			return err
+		}
+	} else {
+		setProcessGroup(s.subprocess, s.tty)
+		s.subprocess.Stdin = os.Stdin
+		s.subprocess.Stdout = os.Stdout
+		s.subprocess.Stderr = os.Stderr
+	}
+
+	err := s.subprocess.Start()
+	if pty != nil {
+		pty.started()
+		if err != nil {
+			pty.detach()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.launched = time.Now()
+	s.logEvent(eventLaunch, "on %s (%s)", provider.Name, currentToken.Label())
+
+	// This goroutine owns the only Wait call for the subprocess
+	exited := make(chan error, 1)
+	go func(cmd *exec.Cmd) {
+		err := cmd.Wait()
+		if pty != nil {
+			pty.detach()
+		}
+		exited <- err
+	}(s.subprocess)
+	s.exited = exited
 
-	return s.subprocess.Start()
+	return nil
+}
+
+// startProxy starts the local proxy for the active provider
+func (s *Supervisor) startProxy() error {
+	provider := s.pool.Active()
+	if provider == nil {
+		return fmt.Errorf("no token available")
+	}
+
+	proxy, err := NewProxy(s.pool, provider, s.observeStatus)
+	if err != nil {
+		return err
+	}
+	if err := proxy.Start(); err != nil {
+		return err
+	}
+
+	s.proxy = proxy
+	return nil
+}
+
+// proxied reports whether token's traffic goes through the proxy
+func (s *Supervisor) proxied(token *tokens.Token) bool {
+	return s.proxy != nil && token.Provider.Domain == s.proxy.provider.Domain
+}
+
+// observeStatus handles limits seen by the proxy. Responses for any token
+// other than the current one are stale and ignored.
+func (s *Supervisor) observeStatus(token string, status *tokens.RateLimitStatus) {
+	current := s.pool.CurrentToken()
+	if current == nil || current.Value != token {
+		return
+	}
+	s.monitor.Report(status, s.statusChan)
+}
+
+// startWatching cancels any running monitor and starts one for the current token.
+// In proxy mode the child's own traffic is watched, so no probes are started.
+func (s *Supervisor) startWatching() error {
+	s.stopWatching()
+
+	currentToken := s.pool.CurrentToken()
+	if currentToken == nil {
+		return fmt.Errorf("no token available")
+	}
+	if s.proxied(currentToken) {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopWatch = cancel
+	go s.monitor.Watch(ctx, currentToken, s.statusChan)
+
+	return nil
+}
+
+// stopWatching cancels the running monitor, if any
+func (s *Supervisor) stopWatching() {
+	if s.stopWatch != nil {
+		s.stopWatch()
+		s.stopWatch = nil
+	}
 }
 
 // handleRotation manages the token rotation process
-func (s *Supervisor) handleRotation(status *RateLimitStatus) {
+func (s *Supervisor) handleRotation(status *tokens.RateLimitStatus) {
+	if active := s.pool.Active(); active != nil && active.Local {
+		s.leaveLocal()
+		return
+	}
+
 	fmt.Printf("\n⚠️  Token limit approaching (%d%% used)\n", status.PercentUsed())
 
+	// The current token is as good as exhausted until its limits reset
+	if current := s.pool.CurrentToken(); current != nil {
+		s.pool.RecordStatus(current.Value, status)
+		resetAt := status.ResetTime
+		if !resetAt.After(time.Now()) {
+			resetAt = time.Now().Add(fallbackResetWait)
+		}
+		s.pool.CoolDown(current.Value, resetAt)
+	}
+
 	if s.interactive {
 		s.promptUser(status)
 	} else {
@@ -131,76 +393,327 @@ func (s *Supervisor) autoRotate() {
 		return
 	}
 
+	if s.proxied(nextToken) {
+		s.hotSwap()
+		return
+	}
+
 	fmt.Println("▶  Auto-rotating to next token...")
 
-	// Gracefully stop subprocess
-	if err := s.subprocess.Process.Signal(syscall.SIGTERM); err != nil {
-		log.Printf("Error sending SIGTERM: %v", err)
+	// Stop monitoring the old token before it is replaced
+	s.stopWatching()
+	s.stopSubprocess("rotation")
+
+	// Rotate token
+	previous := s.pool.CurrentToken()
+	current := s.pool.Next()
+	currentIndex := s.pool.CurrentIndex()
+	totalTokens := s.pool.ActiveTokenCount()
+	fmt.Printf("▶  Switched to token %d/%d (%s)\n", currentIndex+1, totalTokens, current.Label())
+	s.runRotateHook(previous, current)
+
+	// Restart subprocess with new token
+	if err := s.startSubprocess(true); err != nil {
+		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
+		s.exit(1)
 	}
+	fmt.Print("✓ Session resumed\n\n")
+}
 
-	// Wait for process to exit (with timeout)
-	done := make(chan error)
-	go func() {
-		done <- s.subprocess.Wait()
-	}()
+// stopSubprocess sends SIGTERM to the subprocess's process group and waits
+// for it to exit, killing it once the grace period is up. reason is
+// recorded in the event log.
+func (s *Supervisor) stopSubprocess(reason string) error {
+	if err := terminateGroup(s.subprocess); err != nil {
+		log.Printf("Error sending SIGTERM: %v", err)
+	}
 
+	// Wait for the command and then anything it started to exit, killing
+	// whatever is left once the grace period is up
+	deadline := time.After(s.opts.Grace)
+	var err error
 	select {
-	case <-done:
-		// Process exited cleanly
-	case <-time.After(10 * time.Second):
-		// Timeout - force kill
+	case err = <-s.exited:
+		for groupAlive(s.subprocess) {
+			select {
+			case <-deadline:
+				log.Println("Subprocess left processes running, killing them...")
+				killGroup(s.subprocess)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	case <-deadline:
 		log.Println("Subprocess didn't exit cleanly, forcing kill...")
-		s.subprocess.Process.Kill()
-		<-done
+		killGroup(s.subprocess)
+		err = <-s.exited
 	}
+	takeTerminal(s.tty)
+	s.logEvent(eventStop, "for %s, %s", reason, describeExit(err))
+	return err
+}
 
-	// Rotate token
-	s.pool.Next()
-	currentIndex := s.pool.CurrentIndex()
-	totalTokens := s.pool.TotalTokenCount()
-	fmt.Printf("▶  Switched to token %d/%d\n", currentIndex+1, totalTokens)
+// hotSwap rotates the token the proxy injects; the subprocess keeps running
+func (s *Supervisor) hotSwap() {
+	previous := s.pool.CurrentToken()
+	current := s.pool.Next()
+	fmt.Printf("▶  Switched to token %d/%d (%s) - no restart needed\n",
+		s.pool.CurrentIndex()+1, s.pool.ActiveTokenCount(), current.Label())
+	s.logEvent(eventSwap, "to %s", current.Label())
+	s.runRotateHook(previous, current)
+}
 
-	// Restart subprocess with new token
-	if err := s.startSubprocess(); err != nil {
-		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
-		os.Exit(1)
+// runRotateHook runs the on_rotate hook for a switch between tokens
+func (s *Supervisor) runRotateHook(previous, current *tokens.Token) {
+	from := ""
+	if previous != nil {
+		from = previous.Label()
 	}
-	fmt.Println("✓ Session resumed\n")
+	s.runHook("rotate", s.opts.Hooks.OnRotate, "DDOLLAR_FROM="+from, "DDOLLAR_TO="+current.Label())
 }
 
+// printUsageSummary prints what each token consumed, as seen by the proxy
+func (s *Supervisor) printUsageSummary() {
+	if s.proxy == nil {
+		return
+	}
+
+	ledger := s.pool.Ledger()
+	if ledger.Total().Requests == 0 {
+		return
+	}
+
+	fmt.Println("\nUsage:")
+	for _, t := range s.pool.Tokens(s.proxy.provider.Domain) {
+		u := ledger.Get(t.Value)
+		if u.Requests == 0 {
+			continue
+		}
+		fmt.Printf("  %-28s %6d requests  %10d in  %10d out\n", t.Label(), u.Requests, u.InputTokens, u.OutputTokens)
+	}
+}
+
+// fallbackResetWait is used when no token has reported a reset time
+const fallbackResetWait = 1 * time.Minute
+
 // handleAllTokensExhausted handles the case when all tokens hit their limits
 func (s *Supervisor) handleAllTokensExhausted() {
 	fmt.Println("\n⚠️  All tokens exhausted!")
 
-	// For now, estimate reset time (typically 1 minute for rate limits)
-	// TODO: Track actual reset times from rate limit headers
-	shortestReset := 1 * time.Minute
+	// Sleep until the first token's limits reset
+	wait := fallbackResetWait
+	if resetAt := s.pool.EarliestActiveReset(); !resetAt.IsZero() {
+		wait = time.Until(resetAt)
+	}
+	s.runHook("exhausted", s.opts.Hooks.OnExhausted, "DDOLLAR_RESET_AT="+time.Now().Add(wait).Format(time.RFC3339))
+
+	next := s.pool.NextFailover()
+	local := s.pool.LocalFallback()
+	if local != nil && s.pool.Active().Local {
+		local = nil
+	}
 
 	if s.interactive {
+		// Options are numbered in the order they're offered
+		type option struct {
+			label string
+			run   func() bool // Reports whether it handled the exhaustion
+		}
+		options := []option{
+			{fmt.Sprintf("Wait for limits to reset (%s)", formatDuration(wait)), func() bool { return false }},
+			{"Exit and save state", func() bool { s.gracefulExit(); return true }},
+		}
+		if next != nil {
+			options = append(options, option{
+				fmt.Sprintf("Fail over to %s", next.Name),
+				func() bool { return s.failOver(next) },
+			})
+		}
+		if local != nil {
+			options = append(options, option{
+				fmt.Sprintf("Use the local server (%s) until then", local.BaseURL),
+				func() bool { return s.fallBackToLocal(local, wait) },
+			})
+		}
+
 		fmt.Println("\nWhat would you like to do?")
-		fmt.Println("  1) Wait for limits to reset")
-		fmt.Println("  2) Exit and save state")
+		for i, o := range options {
+			fmt.Printf("  %d) %s\n", i+1, o.label)
+		}
 
 		choice := s.readChoice(1)
-
-		switch choice {
-		case 1:
-			fmt.Printf("▶  Pausing for limits to reset (approximately %s)...\n", shortestReset)
-			time.Sleep(shortestReset)
-			s.autoRotate()
-		case 2:
-			s.gracefulExit()
+		if choice >= 2 && choice <= len(options) && options[choice-1].run() {
+			return
+		}
+		fmt.Printf("▶  Pausing %s for limits to reset...\n", formatDuration(wait))
+		if s.pause(wait) {
+			s.resumeAfterReset()
 		}
 	} else {
-		// Headless mode - wait and retry
-		fmt.Printf("▶  Waiting for limits to reset (approximately %s)...\n", shortestReset)
-		time.Sleep(shortestReset)
-		s.autoRotate()
+		// Headless mode - move on to the next provider in the failover
+		// chain, or degrade to the local server if there is one, otherwise
+		// wait and retry
+		if next != nil && s.failOver(next) {
+			return
+		}
+		if local != nil && s.fallBackToLocal(local, wait) {
+			return
+		}
+		fmt.Printf("▶  Waiting %s for limits to reset...\n", formatDuration(wait))
+		if s.pause(wait) {
+			s.resumeAfterReset()
+		}
+	}
+}
+
+// failOver restarts the subprocess against next, the following provider
+// in the failover chain, using its command template if it has one
+func (s *Supervisor) failOver(next *tokens.Provider) bool {
+	previous := s.pool.CurrentToken()
+
+	s.stopWatching()
+	s.stopSubprocess("failover to " + next.Name)
+	if err := s.pool.SetActive(next.Domain); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		s.exit(1)
+	}
+	current := s.pool.CurrentToken()
+	if !s.pool.CoolingUntil(current.Value).IsZero() {
+		current = s.pool.Next()
+	}
+	fmt.Printf("▶  Failing over to %s (token %d/%d, %s)\n", next.Name, s.pool.CurrentIndex()+1, s.pool.ActiveTokenCount(), current.Label())
+	s.runRotateHook(previous, current)
+
+	if err := s.startSubprocess(true); err != nil {
+		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
+		s.exit(1)
+	}
+	fmt.Print("✓ Session resumed\n\n")
+	return true
+}
+
+// localHealthTimeout bounds the health check made before falling back
+const localHealthTimeout = 5 * time.Second
+
+// fallBackToLocal restarts the subprocess against the local server until
+// wait has passed. Returns false, changing nothing, if the server is down.
+func (s *Supervisor) fallBackToLocal(local *tokens.Provider, wait time.Duration) bool {
+	localTokens := s.pool.Tokens(local.Domain)
+	if len(localTokens) == 0 {
+		return false
 	}
+	token := localTokens[0]
+
+	ctx, cancel := context.WithTimeout(context.Background(), localHealthTimeout)
+	defer cancel()
+	if err := s.monitor.CheckHealth(ctx, token); err != nil {
+		fmt.Printf("⚠️  Local server unavailable: %v\n", err)
+		return false
+	}
+
+	fmt.Printf("▶  Falling back to local server (%s) for %s...\n", local.BaseURL, formatDuration(wait))
+	previous := s.pool.CurrentToken()
+	s.cloud = s.pool.Active().Domain
+
+	s.stopWatching()
+	s.stopSubprocess("local fallback")
+	if err := s.pool.SetActive(local.Domain); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		s.exit(1)
+	}
+	s.runRotateHook(previous, token)
+
+	if err := s.startSubprocess(true); err != nil {
+		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
+		s.exit(1)
+	}
+	s.switchBack = time.After(wait)
+	fmt.Print("✓ Session resumed on local server\n\n")
+	return true
+}
+
+// switchBackToCloud returns from the local server to the cloud provider
+// once one of its tokens is usable again, or waits some more
+func (s *Supervisor) switchBackToCloud() {
+	s.switchBack = nil
+
+	if s.cloudToken() == nil {
+		// Limits were pushed back while we were away
+		s.switchBack = time.After(s.cloudResetWait())
+		return
+	}
+
+	fmt.Println("\n▶  Limits reset, switching back from local server...")
+	previous := s.pool.CurrentToken()
+
+	s.stopWatching()
+	s.stopSubprocess("switch back from local server")
+	if err := s.pool.SetActive(s.cloud); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		s.exit(1)
+	}
+	current := s.pool.CurrentToken()
+	if !s.pool.CoolingUntil(current.Value).IsZero() {
+		current = s.pool.Next()
+	}
+	fmt.Printf("▶  Switched to token %d/%d (%s)\n", s.pool.CurrentIndex()+1, s.pool.ActiveTokenCount(), current.Label())
+	s.runRotateHook(previous, current)
+
+	if err := s.startSubprocess(true); err != nil {
+		fmt.Printf("ERROR: Failed to restart subprocess: %v\n", err)
+		s.exit(1)
+	}
+	fmt.Print("✓ Session resumed\n\n")
+}
+
+// leaveLocal moves off a local server that stopped answering: back to the
+// cloud provider if one of its tokens has reset, otherwise after waiting
+// for the first one to
+func (s *Supervisor) leaveLocal() {
+	fmt.Println("\n⚠️  Local server stopped responding")
+	if s.cloud == "" {
+		fmt.Println("⚠️  No cloud provider to switch back to")
+		return
+	}
+
+	if s.cloudToken() == nil {
+		wait := s.cloudResetWait()
+		fmt.Printf("▶  Waiting %s for limits to reset...\n", formatDuration(wait))
+		if !s.pause(wait) {
+			return
+		}
+	}
+	s.switchBackToCloud()
+}
+
+// cloudToken returns the cloud provider's token to switch back to, or nil
+// if all of them are still cooling down
+func (s *Supervisor) cloudToken() *tokens.Token {
+	next := s.pool.CurrentTokenFor(s.cloud)
+	if next == nil || !s.pool.CoolingUntil(next.Value).IsZero() {
+		next = s.pool.PeekFor(s.cloud)
+	}
+	return next
+}
+
+// cloudResetWait returns how long until the cloud provider's first token resets
+func (s *Supervisor) cloudResetWait() time.Duration {
+	if resetAt := s.pool.EarliestReset(s.cloud); !resetAt.IsZero() {
+		return time.Until(resetAt)
+	}
+	return fallbackResetWait
+}
+
+// resumeAfterReset keeps the current token if it has reset, otherwise rotates
+func (s *Supervisor) resumeAfterReset() {
+	if current := s.pool.CurrentToken(); current != nil && s.pool.CoolingUntil(current.Value).IsZero() {
+		fmt.Println("▶  Limits reset, continuing with current token")
+		return
+	}
+	s.autoRotate()
 }
 
 // promptUser presents interactive options when limit is hit
-func (s *Supervisor) promptUser(status *RateLimitStatus) {
+func (s *Supervisor) promptUser(status *tokens.RateLimitStatus) {
 	fmt.Println("\nWhat would you like to do?")
 	fmt.Println("  1) Rotate to next token and continue")
 	fmt.Printf("  2) Wait for limit to reset (%s)\n", formatDuration(status.TimeUntilReset()))
@@ -217,12 +730,12 @@ func (s *Supervisor) promptUser(status *RateLimitStatus) {
 	case 3:
 		s.gracefulExit()
 	case 4:
-		fmt.Println("▶  Continuing with current token...\n")
+		fmt.Print("▶  Continuing with current token...\n\n")
 	}
 }
 
 // waitForReset pauses the subprocess until the rate limit resets
-func (s *Supervisor) waitForReset(status *RateLimitStatus) {
+func (s *Supervisor) waitForReset(status *tokens.RateLimitStatus) {
 	duration := status.TimeUntilReset()
 	fmt.Printf("▶  Waiting %s for limits to reset...\n", formatDuration(duration))
 
@@ -230,31 +743,60 @@ func (s *Supervisor) waitForReset(status *RateLimitStatus) {
 	// On Unix, we could pause the process, but for cross-platform compatibility
 	// we just wait and let the process continue running
 
-	time.Sleep(duration)
-	fmt.Println("▶  Limit reset, continuing...")
+	if s.pause(duration) {
+		fmt.Println("▶  Limit reset, continuing...")
+	}
 }
 
 // gracefulExit stops the subprocess and exits
 func (s *Supervisor) gracefulExit() {
 	fmt.Println("▶  Stopping subprocess gracefully...")
 
-	if err := s.subprocess.Process.Signal(syscall.SIGTERM); err != nil {
-		log.Printf("Error sending SIGTERM: %v", err)
-		s.subprocess.Process.Kill()
-	} else {
-		s.subprocess.Wait()
+	s.stopWatching()
+
+	err := s.stopSubprocess("exit")
+	s.printEventLog()
+	s.runHook("exit", s.opts.Hooks.OnExit, fmt.Sprintf("DDOLLAR_EXIT_CODE=%d", exitCode(err)))
+
+	if err := s.pool.SaveState(); err != nil {
+		log.Printf("Warning: failed to save pool state: %v", err)
 	}
+	s.pool.ReleaseLeases()
 
-	fmt.Println("✓ Session saved. Run with --continue to resume.")
-	os.Exit(0)
+	if template := s.opts.ResumeFor(s.command); len(template) > 0 {
+		fmt.Printf("✓ Session saved. Resume with: ddollar %s\n", strings.Join(expandResume(template, s.command), " "))
+	} else {
+		fmt.Println("✓ Session saved.")
+	}
+	s.exit(0)
 }
 
 // readChoice prompts for user input and returns the choice
 func (s *Supervisor) readChoice(defaultChoice int) int {
-	reader := bufio.NewReader(os.Stdin)
+	// Take the terminal from the subprocess while reading, so keystrokes
+	// come to us
+	takeTerminal(s.tty)
+	defer func() {
+		if groupAlive(s.subprocess) {
+			giveTerminal(s.tty, s.subprocess)
+		}
+	}()
+
 	fmt.Printf("\nChoice [%d]: ", defaultChoice)
 
-	input, err := reader.ReadString('\n')
+	var input string
+	var err error
+	if s.console != nil {
+		input, err = s.console.readLine()
+		// Full-screen programs redraw on SIGWINCH, covering the prompt
+		defer func() {
+			if groupAlive(s.subprocess) {
+				signalGroup(s.subprocess, resizeSignal)
+			}
+		}()
+	} else {
+		input, err = bufio.NewReader(os.Stdin).ReadString('\n')
+	}
 	if err != nil {
 		return defaultChoice
 	}
@@ -272,6 +814,14 @@ func (s *Supervisor) readChoice(defaultChoice int) int {
 	return choice
 }
 
+// exit puts the terminal back, if PTY mode changed it, and exits
+func (s *Supervisor) exit(code int) {
+	if s.console != nil {
+		s.console.Close()
+	}
+	os.Exit(code)
+}
+
 // formatDuration formats a duration in human-readable form
 func formatDuration(d time.Duration) string {
 	d = d.Round(time.Second)
@@ -0,0 +1,79 @@
+package supervisor
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+func TestPauseForwardsTermination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no process groups")
+	}
+	cmd := exec.Command("sleep", "30")
+	setProcessGroup(cmd, -1)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	signals := make(chan os.Signal, 1)
+	s := &Supervisor{subprocess: cmd, signals: signals}
+	if !s.pause(10 * time.Millisecond) {
+		t.Fatal("a quiet pause was cut short")
+	}
+
+	signals <- syscall.SIGTERM
+	done := make(chan bool, 1)
+	go func() { done <- s.pause(time.Hour) }()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("pause ran its course despite SIGTERM")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not end the pause")
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		killGroup(cmd)
+		t.Fatal("SIGTERM was not forwarded to the command")
+	}
+}
+
+func TestResumeFollowsTheTemplate(t *testing.T) {
+	groq := tokens.GetProviderByName("Groq")
+	anthropic := tokens.GetProviderByName("Anthropic")
+	commands := Commands{"groq": {Command: []string{"aider", "{args}"}}}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		provider *tokens.Provider
+		want     string
+	}{
+		{"preset of the typed program", Options{ResumePresets: true}, anthropic, "claude -p hi --continue"},
+		{"preset of the template's program", Options{ResumePresets: true}, groq, "aider -p hi --restore-chat-history"},
+		{"explicit resume wraps the template", Options{Resume: ResumeArgs("--again")}, groq, "aider -p hi --again"},
+		{"no resume", Options{}, groq, "aider -p hi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Commands = commands
+			s := &Supervisor{command: []string{"claude", "-p", "hi"}, opts: tt.opts}
+			command, _ := s.launchCommand(tt.provider, "key", "", true)
+			if got := strings.Join(command, " "); got != tt.want {
+				t.Errorf("resumed as %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"sync"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+// maxUsageBuffer caps how much of a response is held for usage parsing
+const maxUsageBuffer = 1 << 20
+
+// usageReader passes a response body through untouched while parsing the
+// usage it reports on the side. SSE streams are parsed line by line as they
+// flow; plain JSON bodies are parsed once complete. The total is recorded
+// when the body hits EOF or is closed, whichever comes first.
+type usageReader struct {
+	body   io.ReadCloser
+	stream bool
+	record func(tokens.Usage)
+
+	buf      bytes.Buffer // partial SSE line, or the whole JSON body
+	overflow bool         // buf hit maxUsageBuffer and holds a truncated line or body
+	seen     usageCounts
+	once     sync.Once
+}
+
+// usageCounts tracks the largest counts seen; both vendors report
+// cumulative totals, so the maximum is the final figure
+type usageCounts struct {
+	input  int64
+	output int64
+}
+
+// usageFields covers Anthropic and OpenAI usage objects
+type usageFields struct {
+	InputTokens         int64 `json:"input_tokens"`
+	OutputTokens        int64 `json:"output_tokens"`
+	CacheCreationTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadTokens     int64 `json:"cache_read_input_tokens"`
+	PromptTokens        int64 `json:"prompt_tokens"`
+	CompletionTokens    int64 `json:"completion_tokens"`
+}
+
+// usagePayload finds usage wherever a response or event puts it:
+// top level (message_delta, OpenAI chunks and bodies), under "message"
+// (message_start) or under "response" (OpenAI Responses API events)
+type usagePayload struct {
+	Usage   *usageFields `json:"usage"`
+	Message *struct {
+		Usage *usageFields `json:"usage"`
+	} `json:"message"`
+	Response *struct {
+		Usage *usageFields `json:"usage"`
+	} `json:"response"`
+}
+
+// newUsageReader wraps body if its content type carries usage, or returns
+// nil if there is nothing to parse
+func newUsageReader(body io.ReadCloser, contentType string, record func(tokens.Usage)) *usageReader {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/event-stream":
+		return &usageReader{body: body, stream: true, record: record}
+	case "application/json":
+		return &usageReader{body: body, record: record}
+	}
+	return nil
+}
+
+// Read implements io.Reader
+func (r *usageReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.consume(p[:n])
+	}
+	if err == io.EOF {
+		r.finish()
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (r *usageReader) Close() error {
+	r.finish()
+	return r.body.Close()
+}
+
+// consume feeds bytes that have already been passed to the child
+func (r *usageReader) consume(chunk []byte) {
+	if !r.stream {
+		r.buffer(chunk)
+		return
+	}
+
+	for len(chunk) > 0 {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			r.buffer(chunk)
+			return
+		}
+
+		r.buffer(chunk[:i])
+		if !r.overflow {
+			r.parseLine(r.buf.Bytes())
+		}
+		r.buf.Reset()
+		r.overflow = false
+		chunk = chunk[i+1:]
+	}
+}
+
+// buffer holds chunk for parsing unless that would exceed maxUsageBuffer,
+// in which case the line (or body) is given up on
+func (r *usageReader) buffer(chunk []byte) {
+	if r.overflow || r.buf.Len()+len(chunk) > maxUsageBuffer {
+		r.overflow = true
+		return
+	}
+	r.buf.Write(chunk)
+}
+
+// parseLine handles one SSE line; only data lines can carry usage
+func (r *usageReader) parseLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	r.parseJSON(bytes.TrimSpace(data))
+}
+
+// parseJSON extracts usage from one JSON document
+func (r *usageReader) parseJSON(data []byte) {
+	if len(data) == 0 || data[0] != '{' {
+		return // e.g. OpenAI's "[DONE]"
+	}
+
+	var payload usagePayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return
+	}
+
+	r.observe(payload.Usage)
+	if payload.Message != nil {
+		r.observe(payload.Message.Usage)
+	}
+	if payload.Response != nil {
+		r.observe(payload.Response.Usage)
+	}
+}
+
+// observe folds one usage object into the running counts
+func (r *usageReader) observe(u *usageFields) {
+	if u == nil {
+		return
+	}
+
+	input := u.InputTokens + u.CacheCreationTokens + u.CacheReadTokens + u.PromptTokens
+	output := u.OutputTokens + u.CompletionTokens
+
+	r.seen.input = max(r.seen.input, input)
+	r.seen.output = max(r.seen.output, output)
+}
+
+// finish records the totals exactly once
+func (r *usageReader) finish() {
+	r.once.Do(func() {
+		switch {
+		case r.overflow:
+			// Truncated: nothing reliable left to parse
+		case r.stream:
+			if r.buf.Len() > 0 {
+				r.parseLine(r.buf.Bytes())
+			}
+		default:
+			r.parseJSON(bytes.TrimSpace(r.buf.Bytes()))
+		}
+		r.buf.Reset()
+
+		r.record(tokens.Usage{
+			Requests:     1,
+			InputTokens:  r.seen.input,
+			OutputTokens: r.seen.output,
+		})
+	})
+}
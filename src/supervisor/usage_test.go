@@ -0,0 +1,50 @@
+package supervisor
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/drawohara/ddollar/src/tokens"
+)
+
+func TestUsageReaderCapsLongSSELines(t *testing.T) {
+	// An oversized data line delivered in one chunk with its newline,
+	// followed by a normal usage event
+	long := "data: {\"pad\":\"" + strings.Repeat("x", 2*maxUsageBuffer) + "\"}\n"
+	event := "data: {\"usage\":{\"input_tokens\":12,\"output_tokens\":34}}\n"
+
+	var got tokens.Usage
+	r := newUsageReader(io.NopCloser(strings.NewReader("")), "text/event-stream", func(u tokens.Usage) { got = u })
+
+	r.consume([]byte(long[:100]))
+	r.consume([]byte(long[100:] + event))
+	// The line is parsed and dropped at its newline, so check what the
+	// buffer had to grow to, not what it holds now
+	if r.buf.Cap() > maxUsageBuffer {
+		t.Fatalf("buffer grew to %d bytes, cap is %d", r.buf.Cap(), maxUsageBuffer)
+	}
+	r.Close()
+
+	if got.InputTokens != 12 || got.OutputTokens != 34 {
+		t.Errorf("got usage %+v, want 12 in / 34 out from the event after the long line", got)
+	}
+}
+
+func TestUsageReaderSkipsTruncatedJSON(t *testing.T) {
+	body := `{"usage":{"input_tokens":5,"output_tokens":6},"pad":"` + strings.Repeat("x", maxUsageBuffer) + `"}`
+
+	var got tokens.Usage
+	r := newUsageReader(io.NopCloser(bytes.NewReader([]byte(body))), "application/json", func(u tokens.Usage) { got = u })
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.buf.Len() > maxUsageBuffer {
+		t.Errorf("buffer grew to %d bytes, cap is %d", r.buf.Len(), maxUsageBuffer)
+	}
+	if got.Requests != 1 || got.InputTokens != 0 {
+		t.Errorf("got usage %+v, want the request counted without parsing a truncated body", got)
+	}
+}
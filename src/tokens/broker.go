@@ -0,0 +1,243 @@
+package tokens
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Broker operations understood by `ddollar daemon`
+const (
+	OpLease        = "lease"         // Borrow a token (by provider, or a specific token_id)
+	OpRelease      = "release"       // Give back a lease
+	OpReportStatus = "report-status" // Report limits seen for a token
+	OpList         = "list"          // Describe every token and lease
+	OpRotate       = "rotate"        // Release a lease and lease the provider's next token
+)
+
+// BrokerRequest is one line of JSON sent to the daemon
+type BrokerRequest struct {
+	Op       string            `json:"op"`
+	Provider string            `json:"provider,omitempty"`    // lease: provider name or domain
+	TokenID  string            `json:"token_id,omitempty"`    // lease, report-status: a specific token
+	LeaseID  string            `json:"lease_id,omitempty"`    // release, rotate, report-status
+	TTL      int               `json:"ttl_seconds,omitempty"` // lease: outlive the connection, expiring after this long
+	Status   *RateLimitStatus  `json:"status,omitempty"`      // report-status, rotate: parsed limits
+	Headers  map[string]string `json:"headers,omitempty"`     // report-status: raw response headers to parse
+	Code     int               `json:"http_status,omitempty"` // report-status: response code for Headers
+}
+
+// BrokerResponse is the daemon's one-line JSON reply
+type BrokerResponse struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Lease  *LeaseInfo  `json:"lease,omitempty"`
+	Tokens []TokenInfo `json:"tokens,omitempty"`
+}
+
+// LeaseInfo describes a granted lease. Token is the secret itself, so
+// scripts can borrow keys; it is only ever sent over the local socket.
+type LeaseInfo struct {
+	ID       string    `json:"lease_id"`
+	TokenID  string    `json:"token_id"`
+	Token    string    `json:"token,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Provider string    `json:"provider,omitempty"`
+	Expires  time.Time `json:"expires"`
+
+	Endpoint   string `json:"endpoint,omitempty"`   // For tokens bound to an endpoint (Azure)
+	Deployment string `json:"deployment,omitempty"` // For tokens bound to a deployment (Azure)
+}
+
+// TokenInfo describes a token in a list reply, without its value
+type TokenInfo struct {
+	TokenID      string           `json:"token_id"`
+	Label        string           `json:"label"`
+	Provider     string           `json:"provider"`
+	Leased       bool             `json:"leased"`
+	CoolingUntil time.Time        `json:"cooling_until"`
+	Status       *RateLimitStatus `json:"status,omitempty"`
+	Usage        Usage            `json:"usage"`
+}
+
+// DefaultBrokerSocket returns the daemon's socket path:
+// $XDG_RUNTIME_DIR/ddollar/broker.sock, or broker.sock in the state dir
+func DefaultBrokerSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "ddollar", "broker.sock")
+	}
+	return filepath.Join(StateDir(), "broker.sock")
+}
+
+// BrokerClient talks to `ddollar daemon`. It implements Leaser, so a pool
+// can lease through the daemon instead of lock files, and StatusReporter,
+// so limits seen locally reach the daemon's central cooldown tracking.
+// Leases are bound to the client's connection and end when it closes.
+type BrokerClient struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	leases  map[string]string // TokenID -> lease ID
+	unknown map[string]bool   // TokenIDs the daemon doesn't hold
+}
+
+// DialBroker connects to the daemon listening at path
+func DialBroker(path string) (*BrokerClient, error) {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &BrokerClient{
+		conn:    conn,
+		reader:  bufio.NewReader(conn),
+		leases:  make(map[string]string),
+		unknown: make(map[string]bool),
+	}, nil
+}
+
+// Call sends one request and waits for the reply. A reply with ok=false
+// is returned as an error.
+func (c *BrokerClient) Call(req BrokerRequest) (*BrokerResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	var resp BrokerResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.OK {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// Close ends the connection, releasing its leases
+func (c *BrokerClient) Close() error {
+	return c.conn.Close()
+}
+
+// ErrLeased is the daemon's error for a token leased by someone else
+const ErrLeased = "token is leased"
+
+// ErrUnknownToken is the daemon's error for a token it doesn't hold
+const ErrUnknownToken = "unknown token"
+
+// Acquire implements Leaser
+func (c *BrokerClient) Acquire(id string) (bool, error) {
+	resp, err := c.Call(BrokerRequest{Op: OpLease, TokenID: id})
+	if err != nil {
+		if resp != nil && resp.Error == ErrLeased {
+			return false, nil
+		}
+		return false, err
+	}
+
+	c.mu.Lock()
+	c.leases[id] = resp.Lease.ID
+	c.mu.Unlock()
+	return true, nil
+}
+
+// Release implements Leaser
+func (c *BrokerClient) Release(id string) error {
+	c.mu.Lock()
+	leaseID, held := c.leases[id]
+	delete(c.leases, id)
+	c.mu.Unlock()
+
+	if !held {
+		return nil
+	}
+	_, err := c.Call(BrokerRequest{Op: OpRelease, LeaseID: leaseID})
+	return err
+}
+
+// Leased implements Leaser
+func (c *BrokerClient) Leased(id string) bool {
+	infos, err := c.ListTokens()
+	if err != nil {
+		return false
+	}
+	for _, t := range infos {
+		if t.TokenID == id {
+			return t.Leased
+		}
+	}
+	return false
+}
+
+// ListTokens implements TokenLister. Tokens leased through this client
+// are reported as not leased, since no other process holds them.
+func (c *BrokerClient) ListTokens() ([]TokenInfo, error) {
+	resp, err := c.Call(BrokerRequest{Op: OpList})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range resp.Tokens {
+		if _, ours := c.leases[resp.Tokens[i].TokenID]; ours {
+			resp.Tokens[i].Leased = false
+		}
+	}
+	return resp.Tokens, nil
+}
+
+// ReportStatus implements StatusReporter. Tokens the daemon doesn't hold,
+// which it can only coordinate by ID, have nowhere to keep a status; they
+// are skipped quietly from then on.
+func (c *BrokerClient) ReportStatus(id string, status *RateLimitStatus) error {
+	c.mu.Lock()
+	skip := c.unknown[id]
+	c.mu.Unlock()
+	if skip {
+		return nil
+	}
+
+	resp, err := c.Call(BrokerRequest{Op: OpReportStatus, TokenID: id, Status: status})
+	if err != nil && resp != nil && resp.Error == ErrUnknownToken {
+		c.mu.Lock()
+		c.unknown[id] = true
+		c.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
+// StatusReporter is implemented by leasers that want every status the pool records
+type StatusReporter interface {
+	ReportStatus(id string, status *RateLimitStatus) error
+}
+
+// TokenLister is implemented by leasers that track every token centrally.
+// The pool lists once per rotation instead of asking Leased per token, and
+// honors the cooldowns other processes reported.
+type TokenLister interface {
+	ListTokens() ([]TokenInfo, error)
+}
+
+// String describes the client for startup output
+func (c *BrokerClient) String() string {
+	return fmt.Sprintf("ddollar daemon at %s", c.conn.RemoteAddr())
+}
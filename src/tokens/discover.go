@@ -2,17 +2,31 @@ package tokens
 
 import (
 	"bufio"
+	"fmt"
+	"log"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 // ProviderTokens holds discovered tokens for a provider
 type ProviderTokens struct {
 	Provider *Provider
-	Tokens   []string
+	Tokens   []Token
 }
 
-// Discover scans environment variables for API tokens
+// Values returns the raw token values in discovery order
+func (pt ProviderTokens) Values() []string {
+	values := make([]string, len(pt.Tokens))
+	for i, t := range pt.Tokens {
+		values[i] = t.Value
+	}
+	return values
+}
+
+// Discover scans environment variables for API tokens. A local server
+// named by DDOLLAR_LOCAL_URL comes last.
 func Discover() []ProviderTokens {
 	var results []ProviderTokens
 
@@ -28,57 +42,220 @@ func Discover() []ProviderTokens {
 		}
 	}
 
+	if local, ok := discoverLocal(); ok {
+		results = append(results, local)
+	}
+
 	return results
 }
 
 // discoverProviderTokens finds all tokens for a specific provider
-func discoverProviderTokens(provider *Provider) []string {
-	var tokens []string
-	seen := make(map[string]bool)
+func discoverProviderTokens(provider *Provider) []Token {
+	var tokens []Token
+	sources := make(map[string]bool)
 
-	// Helper to add token if not already seen
-	addToken := func(token string) {
+	// Helper to collect a token once per source; duplicate values are
+	// dropped below
+	addToken := func(token, source string) {
 		token = strings.TrimSpace(token)
-		if token != "" && !seen[token] {
-			seen[token] = true
-			tokens = append(tokens, token)
+		if token != "" && !sources[source] {
+			sources[source] = true
+			tokens = append(tokens, Token{
+				Value:    token,
+				Provider: provider,
+				Source:   source,
+			})
 		}
 	}
 
+	environ := os.Environ()
+
 	// 1. Check primary env var (e.g., ANTHROPIC_API_KEY)
 	if len(provider.EnvVars) > 0 {
 		primaryVar := provider.EnvVars[0]
 		if value := os.Getenv(primaryVar); value != "" {
-			addToken(value)
+			addToken(value, primaryVar)
 		}
 
-		// 2. Check for comma-separated list (e.g., ANTHROPIC_API_KEYS)
+		// 2. Check suffixed variants (e.g., ANTHROPIC_API_KEY_2, ANTHROPIC_API_KEY_TEAM_A)
+		for _, name := range suffixedEnvVars(environ, primaryVar) {
+			addToken(os.Getenv(name), name)
+		}
+
+		// 3. Check for comma-separated list (e.g., ANTHROPIC_API_KEYS)
 		pluralVar := primaryVar + "S"
 		if value := os.Getenv(pluralVar); value != "" {
-			for _, token := range strings.Split(value, ",") {
-				addToken(token)
+			for i, token := range strings.Split(value, ",") {
+				addToken(token, fmt.Sprintf("%s[%d]", pluralVar, i+1))
 			}
 		}
 
-		// 3. Check for file with tokens (e.g., ANTHROPIC_API_KEYS_FILE)
+		// 4. Check for file with tokens (e.g., ANTHROPIC_API_KEYS_FILE)
 		fileVar := primaryVar + "S_FILE"
 		if filePath := os.Getenv(fileVar); filePath != "" {
 			if fileTokens := readTokensFromFile(filePath); len(fileTokens) > 0 {
-				for _, token := range fileTokens {
-					addToken(token)
+				for i, token := range fileTokens {
+					addToken(token, fmt.Sprintf("%s[%d]", fileVar, i+1))
 				}
 			}
 		}
 	}
 
-	// 4. Check all other env var aliases (for backwards compatibility)
+	// 5. Check all other env var aliases and their suffixed variants
 	for _, envVar := range provider.EnvVars {
 		if value := os.Getenv(envVar); value != "" {
-			addToken(value)
+			addToken(value, envVar)
+		}
+		for _, name := range suffixedEnvVars(environ, envVar) {
+			addToken(os.Getenv(name), name)
 		}
 	}
 
-	return tokens
+	// Endpoints are bound before deduplicating so one key used with several
+	// endpoints or deployments yields a token for each
+	if provider.EndpointEnv != "" {
+		tokens = bindEndpoints(provider, tokens)
+	}
+
+	return dedupTokens(tokens)
+}
+
+// dedupTokens drops repeats of a token value bound to the same endpoint and
+// deployment, keeping the first
+func dedupTokens(tokens []Token) []Token {
+	seen := make(map[[3]string]bool)
+	unique := tokens[:0]
+	for _, t := range tokens {
+		key := [3]string{t.Value, t.Endpoint, t.Deployment}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// bindEndpoints pairs each token with the endpoint and deployment env vars
+// sharing its suffix, falling back to the unsuffixed ones. Tokens from lists
+// and files use the unsuffixed ones. Tokens left without an endpoint can't
+// be used and are dropped.
+func bindEndpoints(provider *Provider, tokens []Token) []Token {
+	lookup := func(base, suffix string) string {
+		if base == "" {
+			return ""
+		}
+		if value := os.Getenv(base + suffix); value != "" {
+			return value
+		}
+		return os.Getenv(base)
+	}
+
+	var bound []Token
+	for _, t := range tokens {
+		suffix := ""
+		for _, envVar := range provider.EnvVars {
+			if rest, ok := strings.CutPrefix(t.Source, envVar); ok && !strings.Contains(rest, "[") {
+				suffix = rest
+				break
+			}
+		}
+
+		if t.Endpoint == "" {
+			t.Endpoint = lookup(provider.EndpointEnv, suffix)
+		}
+		if t.Deployment == "" {
+			t.Deployment = lookup(provider.DeploymentEnv, suffix)
+		}
+		if t.Endpoint == "" {
+			log.Printf("Warning: skipping %s token from %s: no %s set", provider.Name, t.Source, provider.EndpointEnv+suffix)
+			continue
+		}
+		bound = append(bound, t)
+	}
+	return bound
+}
+
+// suffixedEnvVars returns the names of env vars of the form BASE_<suffix>,
+// numeric suffixes first in numeric order, then named suffixes alphabetically
+func suffixedEnvVars(environ []string, base string) []string {
+	prefix := base + "_"
+
+	type candidate struct {
+		name   string
+		suffix string
+		num    int
+		isNum  bool
+	}
+
+	var candidates []candidate
+	for _, kv := range environ {
+		name, _, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		suffix := name[len(prefix):]
+		if !isValidSuffix(suffix) {
+			continue
+		}
+
+		c := candidate{name: name, suffix: suffix}
+		if n, err := strconv.Atoi(suffix); err == nil {
+			c.num = n
+			c.isNum = true
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.isNum != b.isNum {
+			return a.isNum
+		}
+		if a.isNum && a.num != b.num {
+			return a.num < b.num
+		}
+		return a.suffix < b.suffix
+	})
+
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.name
+	}
+	return names
+}
+
+// IsTokenEnvVar reports whether name is one discovery reads tokens from:
+// a provider's env var, a suffixed or plural form of it, or its list file
+func IsTokenEnvVar(name string) bool {
+	for _, p := range SupportedProviders {
+		for _, envVar := range p.EnvVars {
+			if name == envVar || name == envVar+"S" || name == envVar+"S_FILE" {
+				return true
+			}
+			if suffix, ok := strings.CutPrefix(name, envVar+"_"); ok && isValidSuffix(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isValidSuffix reports whether s looks like a token suffix (e.g. "2", "TEAM_A")
+func isValidSuffix(s string) bool {
+	if s == "" || strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") {
+		return false
+	}
+	// FOO_API_KEY_FILE conventionally holds a path, not a token
+	if s == "FILE" || strings.HasSuffix(s, "_FILE") {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
 }
 
 // readTokensFromFile reads tokens from a file, one per line
@@ -106,7 +283,7 @@ func readTokensFromFile(filePath string) []string {
 func DiscoverForProvider(providerName string) []string {
 	for _, provider := range SupportedProviders {
 		if strings.EqualFold(provider.Name, providerName) {
-			return discoverProviderTokens(&provider)
+			return ProviderTokens{Tokens: discoverProviderTokens(&provider)}.Values()
 		}
 	}
 	return nil
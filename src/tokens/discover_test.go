@@ -0,0 +1,158 @@
+package tokens
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuffixedEnvVars(t *testing.T) {
+	environ := []string{
+		"FOO_API_KEY=primary",
+		"FOO_API_KEY_TEAM_B=b",
+		"FOO_API_KEY_10=ten",
+		"FOO_API_KEY_2=two",
+		"FOO_API_KEY_TEAM_A=a",
+		"FOO_API_KEY_1=one",
+		"FOO_API_KEY_FILE=/path",      // A path, not a token
+		"FOO_API_KEY_WORK_FILE=/path", // Likewise
+		"FOO_API_KEY__LEADING=x",
+		"FOO_API_KEY_TRAILING_=x",
+		"FOO_API_KEY_=x",
+		"FOO_API_KEY_BAD-CHAR=x",
+		"FOO_API_KEYS=list",
+		"OTHER_FOO_API_KEY_3=x",
+	}
+
+	got := suffixedEnvVars(environ, "FOO_API_KEY")
+	want := []string{"FOO_API_KEY_1", "FOO_API_KEY_2", "FOO_API_KEY_10", "FOO_API_KEY_TEAM_A", "FOO_API_KEY_TEAM_B"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestIsValidSuffix(t *testing.T) {
+	for suffix, want := range map[string]bool{
+		"2":         true,
+		"TEAM_A":    true,
+		"work":      true,
+		"":          false,
+		"_A":        false,
+		"A_":        false,
+		"FILE":      false,
+		"WORK_FILE": false,
+		"A-B":       false,
+		"A.B":       false,
+	} {
+		if got := isValidSuffix(suffix); got != want {
+			t.Errorf("isValidSuffix(%q) = %v, want %v", suffix, got, want)
+		}
+	}
+}
+
+func TestDiscoveryDedupsAcrossSources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(file, []byte("key-file\nkey-b\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"DDTEST_API_KEY":       "key-a",
+		"DDTEST_API_KEY_2":     "key-b",
+		"DDTEST_API_KEY_1":     "key-a", // Same as the primary
+		"DDTEST_API_KEYS":      "key-c, key-b ,key-a",
+		"DDTEST_API_KEYS_FILE": file,
+		"DDTEST_TOKEN":         "key-c", // Alias, same as a list entry
+		"DDTEST_TOKEN_TEAM":    "key-d",
+	} {
+		t.Setenv(name, value)
+	}
+	provider := &Provider{Name: "DDTest", Domain: "ddtest.example", EnvVars: []string{"DDTEST_API_KEY", "DDTEST_TOKEN"}}
+
+	var got []string
+	for _, token := range discoverProviderTokens(provider) {
+		got = append(got, token.Value+"<"+token.Source)
+	}
+	want := []string{
+		"key-a<DDTEST_API_KEY",
+		"key-b<DDTEST_API_KEY_2",
+		"key-c<DDTEST_API_KEYS[1]",
+		"key-file<DDTEST_API_KEYS_FILE[1]",
+		"key-d<DDTEST_TOKEN_TEAM",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+func TestDiscoveryBindsEndpoints(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(file, []byte("key-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "suffixes pair up",
+			env: map[string]string{
+				"DDTEST_KEY": "key-a", "DDTEST_ENDPOINT": "https://a", "DDTEST_DEPLOYMENT": "dep-a",
+				"DDTEST_KEY_2": "key-b", "DDTEST_ENDPOINT_2": "https://b", "DDTEST_DEPLOYMENT_2": "dep-b",
+			},
+			want: []string{"key-a@https://a/dep-a", "key-b@https://b/dep-b"},
+		},
+		{
+			name: "unsuffixed fallback",
+			env: map[string]string{
+				"DDTEST_KEY_2": "key-b", "DDTEST_ENDPOINT": "https://a", "DDTEST_DEPLOYMENT": "dep-a",
+				"DDTEST_KEY_3": "key-c", "DDTEST_ENDPOINT_3": "https://c",
+			},
+			want: []string{"key-b@https://a/dep-a", "key-c@https://c/dep-a"},
+		},
+		{
+			name: "lists and files use the unsuffixed vars",
+			env: map[string]string{
+				"DDTEST_KEYS": "key-a,key-b", "DDTEST_KEYS_FILE": file,
+				"DDTEST_ENDPOINT": "https://a", "DDTEST_ENDPOINT_1": "https://wrong",
+			},
+			want: []string{"key-a@https://a/", "key-b@https://a/", "key-file@https://a/"},
+		},
+		{
+			name: "one key on two deployments",
+			env: map[string]string{
+				"DDTEST_KEY_1": "key-a", "DDTEST_ENDPOINT_1": "https://a", "DDTEST_DEPLOYMENT_1": "dep-1",
+				"DDTEST_KEY_2": "key-a", "DDTEST_ENDPOINT_2": "https://a", "DDTEST_DEPLOYMENT_2": "dep-2",
+				"DDTEST_KEYS": "key-a", "DDTEST_ENDPOINT": "https://a", "DDTEST_DEPLOYMENT": "dep-1",
+			},
+			want: []string{"key-a@https://a/dep-1", "key-a@https://a/dep-2"},
+		},
+		{
+			name: "no endpoint drops the token",
+			env: map[string]string{
+				"DDTEST_KEY": "key-a", "DDTEST_KEY_2": "key-b", "DDTEST_ENDPOINT_2": "https://b",
+			},
+			want: []string{"key-b@https://b/"},
+		},
+	}
+	provider := &Provider{
+		Name: "DDTest", Domain: "ddtest.example", EnvVars: []string{"DDTEST_KEY"},
+		EndpointEnv: "DDTEST_ENDPOINT", DeploymentEnv: "DDTEST_DEPLOYMENT",
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			var got []string
+			for _, token := range discoverProviderTokens(provider) {
+				got = append(got, token.Value+"@"+token.Endpoint+"/"+token.Deployment)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package tokens
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Leaser hands out exclusive claims on tokens across ddollar processes,
+// so concurrent supervisors sharing a key file spread over distinct tokens
+type Leaser interface {
+	// Acquire claims the token with the given TokenID. Returns false if
+	// another process already holds it.
+	Acquire(id string) (bool, error)
+
+	// Release gives up a claim made by Acquire
+	Release(id string) error
+
+	// Leased reports whether another process holds the token
+	Leased(id string) bool
+}
+
+// FileLeaser implements Leaser with one lock file per token in a directory.
+// Locks are released by the OS when the holding process exits, so a
+// crashed supervisor never strands a token.
+type FileLeaser struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[string]*os.File // TokenID -> open, locked file
+}
+
+// NewFileLeaser creates a leaser that keeps lock files in dir
+func NewFileLeaser(dir string) (*FileLeaser, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileLeaser{dir: dir, locks: make(map[string]*os.File)}, nil
+}
+
+// DefaultLeaseDir returns where lease lock files live
+func DefaultLeaseDir() string {
+	return filepath.Join(StateDir(), "leases")
+}
+
+// Acquire implements Leaser
+func (l *FileLeaser) Acquire(id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, held := l.locks[id]; held {
+		return true, nil
+	}
+
+	// Another process's Leased may be probing the lock for an instant;
+	// only a lock still held after a few tries belongs to someone
+	for attempt := 1; ; attempt++ {
+		f, ok, err := lockFile(l.path(id))
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			l.locks[id] = f
+			return true, nil
+		}
+		if attempt == acquireAttempts {
+			return false, nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// acquireAttempts is how many times Acquire tries a contended lock
+const acquireAttempts = 3
+
+// Release implements Leaser
+func (l *FileLeaser) Release(id string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, held := l.locks[id]
+	if !held {
+		return nil
+	}
+	delete(l.locks, id)
+	return unlockFile(f)
+}
+
+// Leased implements Leaser
+func (l *FileLeaser) Leased(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, held := l.locks[id]; held {
+		return false // Held by us, not another process
+	}
+	return lockHeld(l.path(id))
+}
+
+// path returns the lock file for a token
+func (l *FileLeaser) path(id string) string {
+	return filepath.Join(l.dir, id+".lock")
+}
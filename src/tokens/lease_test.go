@@ -0,0 +1,210 @@
+package tokens
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFileLeaserAcquireRelease(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewFileLeaser(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFileLeaser(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := TokenID("key-0")
+
+	if second.Leased(id) {
+		t.Error("leased before anyone acquired it")
+	}
+	if ok, err := first.Acquire(id); !ok || err != nil {
+		t.Fatalf("first acquire = %v, %v", ok, err)
+	}
+	if ok, _ := first.Acquire(id); !ok {
+		t.Error("acquiring a held lease again failed")
+	}
+	if first.Leased(id) {
+		t.Error("our own lease reported as held elsewhere")
+	}
+	if !second.Leased(id) {
+		t.Error("another leaser's lease not reported")
+	}
+	if ok, _ := second.Acquire(id); ok {
+		t.Error("second leaser acquired a held token")
+	}
+
+	if err := first.Release(id); err != nil {
+		t.Fatal(err)
+	}
+	if second.Leased(id) {
+		t.Error("still leased after release")
+	}
+	if ok, _ := second.Acquire(id); !ok {
+		t.Error("could not acquire a released token")
+	}
+}
+
+func TestLeasedProbesDontBlockAcquire(t *testing.T) {
+	dir := t.TempDir()
+	holder, _ := NewFileLeaser(dir)
+	prober, _ := NewFileLeaser(dir)
+	id := TokenID("key-0")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					prober.Leased(id)
+				}
+			}
+		}()
+	}
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	for i := 0; i < 2000; i++ {
+		if ok, err := holder.Acquire(id); !ok || err != nil {
+			t.Fatalf("acquire %d failed while another leaser probed: %v", i, err)
+		}
+		holder.Release(id)
+	}
+}
+
+// leasedPool returns a three-token pool leasing through a FileLeaser in dir
+func leasedPool(t *testing.T, dir string) (*Pool, *FileLeaser) {
+	t.Helper()
+	leaser, err := NewFileLeaser(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := newTestPool(t, RoundRobin{}, 3)
+	pool.SetLeaser(leaser)
+	return pool, leaser
+}
+
+func TestPoolsSkipLeasedTokens(t *testing.T) {
+	dir := t.TempDir()
+	first, firstLeaser := leasedPool(t, dir)
+	second, _ := leasedPool(t, dir)
+
+	if !first.LeaseActive() || first.CurrentToken().Value != "key-0" {
+		t.Fatal("first pool did not lease key-0")
+	}
+	if !second.LeaseActive() {
+		t.Fatal("second pool leased nothing")
+	}
+	if got := second.CurrentToken().Value; got != "key-1" {
+		t.Fatalf("second pool started on %s, want key-1 (key-0 is leased)", got)
+	}
+
+	// Rotating skips the other pool's token and gives up the old lease
+	if got := second.Next().Value; got != "key-2" {
+		t.Errorf("second pool rotated to %s, want key-2", got)
+	}
+	if got := first.Next().Value; got != "key-1" {
+		t.Errorf("first pool rotated to %s, want key-1, freed by the second", got)
+	}
+	if firstLeaser.Leased(TokenID("key-0")) {
+		t.Error("key-0 still leased after the first pool rotated away")
+	}
+	if !firstLeaser.Leased(TokenID("key-2")) {
+		t.Error("the second pool's lease on key-2 not visible")
+	}
+
+	second.ReleaseLeases()
+	if firstLeaser.Leased(TokenID("key-2")) {
+		t.Error("key-2 still leased after ReleaseLeases")
+	}
+}
+
+// slowLeaser blocks in Acquire until released
+type slowLeaser struct {
+	entered, proceed chan struct{}
+}
+
+func (l *slowLeaser) Acquire(id string) (bool, error) {
+	l.entered <- struct{}{}
+	<-l.proceed
+	return true, nil
+}
+
+func (l *slowLeaser) Release(id string) error { return nil }
+func (l *slowLeaser) Leased(id string) bool   { return false }
+
+func TestLeasingHappensOutsideThePoolLock(t *testing.T) {
+	pool := newTestPool(t, RoundRobin{}, 3)
+	leaser := &slowLeaser{entered: make(chan struct{}), proceed: make(chan struct{})}
+	pool.SetLeaser(leaser)
+
+	rotated := make(chan *Token)
+	go func() { rotated <- pool.Next() }()
+	<-leaser.entered
+
+	// While the lease round trip is in flight, the pool still answers
+	if got := pool.CurrentToken().Value; got != "key-1" {
+		t.Errorf("current token %s during leasing, want key-1", got)
+	}
+	close(leaser.proceed)
+	<-rotated
+
+	pool.mu.Lock()
+	leased := pool.providers[testProvider.Domain].stateOf("key-1").leased
+	pool.mu.Unlock()
+	if !leased {
+		t.Error("lease not recorded after it was acquired")
+	}
+}
+
+// countingReporter is a leaser that counts the statuses reported to it
+type countingReporter struct {
+	mu      sync.Mutex
+	reports []RateLimitStatus
+}
+
+func (r *countingReporter) Acquire(id string) (bool, error) { return true, nil }
+func (r *countingReporter) Release(id string) error         { return nil }
+func (r *countingReporter) Leased(id string) bool           { return false }
+
+func (r *countingReporter) ReportStatus(id string, status *RateLimitStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, *status)
+	return nil
+}
+
+func TestStatusReportsAreSentOnlyWhenChanged(t *testing.T) {
+	pool := newTestPool(t, RoundRobin{}, 2)
+	reporter := &countingReporter{}
+	pool.SetLeaser(reporter)
+
+	for i := 0; i < 50; i++ {
+		pool.RecordStatus("key-0", used(10))
+	}
+	pool.ReleaseLeases() // Waits for reports in flight
+	reporter.mu.Lock()
+	sent := len(reporter.reports)
+	reporter.mu.Unlock()
+	if sent < 1 || sent > 2 {
+		t.Errorf("50 identical statuses sent %d reports, want 1 (or 2 if one was in flight)", sent)
+	}
+
+	pool.RecordStatus("key-0", used(20))
+	pool.ReleaseLeases()
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	if last := reporter.reports[len(reporter.reports)-1]; last.RequestsRemaining != 80 {
+		t.Errorf("last report has %d remaining, want the changed 80", last.RequestsRemaining)
+	}
+}
@@ -0,0 +1,68 @@
+//go:build windows
+
+package tokens
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// lockFile creates path exclusively, recording our PID. A lock file left by
+// a process that is no longer running is treated as stale and replaced.
+// Returns ok=false if a live process holds the lock.
+func lockFile(path string) (*os.File, bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o600)
+		if err == nil {
+			f.WriteString(strconv.Itoa(os.Getpid()))
+			return f, true, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, false, err
+		}
+
+		if !staleLock(path) {
+			return nil, false, nil
+		}
+		os.Remove(path)
+	}
+	return nil, false, nil
+}
+
+// lockHeld reports whether a live process holds the lock on path, without
+// touching the lock file
+func lockHeld(path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	return !staleLock(path)
+}
+
+// staleLock reports whether the process recorded in a lock file is gone
+func staleLock(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false // Holder hasn't written its PID yet
+	}
+	// FindProcess opens a handle on Windows, failing if the process is gone
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return true
+	}
+	p.Release()
+	return false
+}
+
+// unlockFile releases a lock taken by lockFile
+func unlockFile(f *os.File) error {
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,66 @@
+package tokens
+
+import "time"
+
+// RateLimitStatus represents the current rate limit state
+type RateLimitStatus struct {
+	RequestsLimit     int       `json:"requests_limit"`
+	RequestsRemaining int       `json:"requests_remaining"`
+	TokensLimit       int       `json:"tokens_limit"`
+	TokensRemaining   int       `json:"tokens_remaining"`
+	ResetTime         time.Time `json:"reset_time"`
+	Provider          string    `json:"provider"`
+}
+
+// same reports whether two statuses describe the same limits. Reset times
+// worked out from relative headers drift by the request's latency, so
+// they only need to agree to the second.
+func (s *RateLimitStatus) same(o *RateLimitStatus) bool {
+	return s.RequestsLimit == o.RequestsLimit && s.RequestsRemaining == o.RequestsRemaining &&
+		s.TokensLimit == o.TokensLimit && s.TokensRemaining == o.TokensRemaining &&
+		s.Provider == o.Provider && s.ResetTime.Sub(o.ResetTime).Abs() < time.Second
+}
+
+// ShouldRotate returns true if usage exceeds the threshold
+func (s *RateLimitStatus) ShouldRotate(threshold float64) bool {
+	return s.RequestsPercentUsed() > threshold*100 || s.TokensPercentUsed() > threshold*100
+}
+
+// RequestsPercentUsed returns the percentage of requests used (0-100)
+func (s *RateLimitStatus) RequestsPercentUsed() float64 {
+	if s.RequestsLimit == 0 {
+		return 0
+	}
+	used := s.RequestsLimit - s.RequestsRemaining
+	return float64(used) / float64(s.RequestsLimit) * 100
+}
+
+// TokensPercentUsed returns the percentage of tokens used (0-100)
+func (s *RateLimitStatus) TokensPercentUsed() float64 {
+	if s.TokensLimit == 0 {
+		return 0
+	}
+	used := s.TokensLimit - s.TokensRemaining
+	return float64(used) / float64(s.TokensLimit) * 100
+}
+
+// PercentUsed returns the higher of requests or tokens percent used
+func (s *RateLimitStatus) PercentUsed() int {
+	reqPercent := s.RequestsPercentUsed()
+	tokPercent := s.TokensPercentUsed()
+
+	if reqPercent > tokPercent {
+		return int(reqPercent)
+	}
+	return int(tokPercent)
+}
+
+// TimeUntilReset returns how long until the rate limit resets
+func (s *RateLimitStatus) TimeUntilReset() time.Duration {
+	return time.Until(s.ResetTime)
+}
+
+// Exhausted returns true if either limit has nothing left
+func (s *RateLimitStatus) Exhausted() bool {
+	return (s.RequestsLimit > 0 && s.RequestsRemaining <= 0) || (s.TokensLimit > 0 && s.TokensRemaining <= 0)
+}
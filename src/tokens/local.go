@@ -0,0 +1,58 @@
+package tokens
+
+import (
+	"net/url"
+	"os"
+	"strings"
+)
+
+// LocalURLEnv names the env var with the base URL of a local
+// OpenAI-compatible server (Ollama, llama.cpp, vLLM), e.g.
+// "http://localhost:11434/v1"
+const LocalURLEnv = "DDOLLAR_LOCAL_URL"
+
+// LocalPlaceholderKey is the API key given to commands talking to a local
+// server; SDKs insist on one, servers ignore it
+const LocalPlaceholderKey = "ddollar-local"
+
+// LocalProvider returns the keyless provider for a local server. Commands
+// reach it through OPENAI_BASE_URL.
+func LocalProvider(baseURL string) *Provider {
+	domain := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		domain = u.Host
+	}
+
+	return &Provider{
+		Name:       "Local",
+		Domain:     domain,
+		EnvVars:    []string{"OPENAI_API_KEY"},
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		BaseURLEnv: "OPENAI_BASE_URL",
+		Local:      true,
+	}
+}
+
+// LocalTokens returns the pool entry for a local server. Its one "token"
+// is the server URL, which the command never sees.
+func LocalTokens(baseURL, source string) ProviderTokens {
+	provider := LocalProvider(baseURL)
+	return ProviderTokens{
+		Provider: provider,
+		Tokens: []Token{{
+			Value:    provider.BaseURL,
+			Provider: provider,
+			Source:   source,
+			Endpoint: provider.BaseURL,
+		}},
+	}
+}
+
+// discoverLocal returns the local server named in the environment, if any
+func discoverLocal() (ProviderTokens, bool) {
+	baseURL := strings.TrimSpace(os.Getenv(LocalURLEnv))
+	if baseURL == "" {
+		return ProviderTokens{}, false
+	}
+	return LocalTokens(baseURL, LocalURLEnv), true
+}
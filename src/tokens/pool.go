@@ -2,37 +2,140 @@ package tokens
 
 import (
 	"fmt"
+	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Token represents a single API token with its provider
 type Token struct {
 	Value    string
 	Provider *Provider
+	Source   string // Where the token was found (e.g. "ANTHROPIC_API_KEY_2"), safe to print
+	Weight   int    // Share for the weighted strategy (0 = 1)
+
+	// For providers where each key belongs to its own resource (Azure)
+	Endpoint   string // API root the token is valid for, e.g. "https://foo.openai.azure.com"
+	Deployment string // Model deployment on that endpoint
+}
+
+// Label returns a printable name for the token that never includes its value
+func (t *Token) Label() string {
+	if t.Source != "" {
+		return t.Source
+	}
+	return MaskToken(t.Value)
 }
 
-// Pool manages token rotation for multiple providers
+// MaskToken hides all but the last four characters of a token
+func MaskToken(value string) string {
+	if len(value) <= 8 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// Pool manages token rotation for multiple providers.
+//
+// Providers are kept in the order they were added. Supervisor mode works
+// against a single active provider, which defaults to the first one added
+// and can be changed with SetActive.
 type Pool struct {
-	mu       sync.Mutex
+	mu        sync.Mutex
 	providers map[string]*ProviderPool // domain -> provider pool
+	order     []string                 // domains in insertion order
+	active    string                   // domain of the supervised provider
+	ledger    *Ledger                  // usage per token value
+	strategy  Strategy                 // picks the token to rotate to
+	statePath string                   // where to persist state, "" to disable
+	stateSeq  uint64                   // numbers state snapshots, newest highest
+	leaser    Leaser                   // coordinates tokens with other processes, if set
+	failover  []string                 // domains to fail over between, in order
+
+	leaseMu sync.Mutex // serializes lease I/O, which happens outside mu
+
+	reportMu sync.Mutex                 // guards the fields below
+	pending  map[string]RateLimitStatus // statuses waiting to be reported, by TokenID
+	reported map[string]RateLimitStatus // last status reported, by TokenID
+	sending  chan struct{}              // closed when the goroutine reporting stops; nil if none runs
+
+	stateMu sync.Mutex       // serializes state file writes; guards the fields below
+	flushed map[string]Usage // ledger usage already merged into the state file, by TokenID
+	written uint64           // stateSeq of the last snapshot written
 }
 
 // ProviderPool manages tokens for a single provider
 type ProviderPool struct {
 	provider *Provider
-	tokens   []string
+	tokens   []Token
 	index    int
+	pending  int                    // choice made by PeekFor for NextFor to honor, or -1
+	rotated  bool                   // the cursor moved this run, so it is worth saving
+	state    map[string]*tokenState // token value -> health
+}
+
+// tokenState is what the pool knows about one token's health
+type tokenState struct {
+	status       *RateLimitStatus // last known limits, nil until observed
+	coolingUntil time.Time        // skipped by rotation until then
+	lastUsed     time.Time        // when the token last became current
+	weight       int              // share for the weighted strategy
+	leased       bool             // we hold this token's lease
 }
 
 // NewPool creates a new token pool
 func NewPool() *Pool {
 	return &Pool{
 		providers: make(map[string]*ProviderPool),
+		ledger:    NewLedger(),
+		strategy:  RoundRobin{},
+		flushed:   make(map[string]Usage),
+		pending:   make(map[string]RateLimitStatus),
+		reported:  make(map[string]RateLimitStatus),
 	}
 }
 
+// SetStrategy sets how the pool picks the token to rotate to
+func (p *Pool) SetStrategy(strategy Strategy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy = strategy
+}
+
+// Strategy returns the pool's rotation strategy
+func (p *Pool) Strategy() Strategy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.strategy
+}
+
+// SetWeight sets a token's share for the weighted strategy
+func (p *Pool) SetWeight(value string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if st := p.stateFor(value); st != nil {
+		st.weight = weight
+	}
+}
+
+// Ledger returns the pool's per-token usage ledger
+func (p *Pool) Ledger() *Ledger {
+	return p.ledger
+}
+
 // AddProvider adds a provider with its tokens to the pool
 func (p *Pool) AddProvider(provider *Provider, tokens []string) error {
+	records := make([]Token, len(tokens))
+	for i, value := range tokens {
+		records[i] = Token{Value: value, Provider: provider}
+	}
+	return p.AddTokens(provider, records)
+}
+
+// AddTokens adds a provider with discovered tokens (including their sources) to the pool
+func (p *Pool) AddTokens(provider *Provider, tokens []Token) error {
 	if len(tokens) == 0 {
 		return fmt.Errorf("no tokens provided for %s", provider.Name)
 	}
@@ -40,15 +143,72 @@ func (p *Pool) AddProvider(provider *Provider, tokens []string) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.providers[provider.Domain] = &ProviderPool{
+	if _, exists := p.providers[provider.Domain]; !exists {
+		p.order = append(p.order, provider.Domain)
+	}
+	if p.active == "" {
+		p.active = provider.Domain
+	}
+
+	pp := &ProviderPool{
 		provider: provider,
 		tokens:   tokens,
 		index:    0,
+		pending:  -1,
+		state:    make(map[string]*tokenState),
+	}
+	pp.stateOf(tokens[0].Value).lastUsed = time.Now()
+	for _, t := range tokens {
+		if t.Weight > 0 {
+			pp.stateOf(t.Value).weight = t.Weight
+		}
 	}
+	p.providers[provider.Domain] = pp
 
 	return nil
 }
 
+// SetActive selects the provider used by supervisor mode.
+// The name may be a provider name ("anthropic") or domain ("api.anthropic.com").
+func (p *Pool) SetActive(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	domain := p.lookup(name)
+	if domain == "" {
+		var names []string
+		for _, d := range p.order {
+			names = append(names, p.providers[d].provider.Name)
+		}
+		return fmt.Errorf("no tokens for provider %q (have: %s)", name, strings.Join(names, ", "))
+	}
+
+	p.active = domain
+	return nil
+}
+
+// Active returns the provider used by supervisor mode
+func (p *Pool) Active() *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pp := p.providers[p.active]; pp != nil {
+		return pp.provider
+	}
+	return nil
+}
+
+// lookup resolves a provider name or domain to a domain in the pool
+func (p *Pool) lookup(name string) string {
+	for _, domain := range p.order {
+		pp := p.providers[domain]
+		if strings.EqualFold(domain, name) || strings.EqualFold(pp.provider.Name, name) {
+			return domain
+		}
+	}
+	return ""
+}
+
 // GetToken returns the next token for a given domain using round-robin
 func (p *Pool) GetToken(domain string) (string, *Provider, error) {
 	p.mu.Lock()
@@ -60,7 +220,7 @@ func (p *Pool) GetToken(domain string) (string, *Provider, error) {
 	}
 
 	// Get current token
-	token := providerPool.tokens[providerPool.index]
+	token := providerPool.tokens[providerPool.index].Value
 
 	// Advance to next token (round-robin)
 	providerPool.index = (providerPool.index + 1) % len(providerPool.tokens)
@@ -83,96 +243,766 @@ func (p *Pool) ProviderCount() int {
 	return len(p.providers)
 }
 
-// TokenCount returns the total number of tokens across all providers
+// TokenCount returns the total number of tokens across all providers. A
+// local server's URL stands in for a token but isn't counted as one.
 func (p *Pool) TokenCount() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	count := 0
 	for _, pp := range p.providers {
-		count += len(pp.tokens)
+		if !pp.provider.Local {
+			count += len(pp.tokens)
+		}
 	}
 	return count
 }
 
-// Providers returns a list of provider names with tokens
+// Providers returns a list of provider names with tokens, in insertion order
 func (p *Pool) Providers() []string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	var names []string
-	for _, pp := range p.providers {
-		names = append(names, pp.provider.Name)
+	for _, domain := range p.order {
+		names = append(names, p.providers[domain].provider.Name)
 	}
 	return names
 }
 
-// TotalTokenCount returns the total number of tokens (alias for TokenCount)
-func (p *Pool) TotalTokenCount() int {
-	return p.TokenCount()
+// SetFailover sets the providers supervisor mode may switch between when
+// one runs out of tokens, in order. Names may be provider names or domains.
+func (p *Pool) SetFailover(names []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var chain []string
+	for _, name := range names {
+		domain := p.lookup(name)
+		if domain == "" {
+			return fmt.Errorf("no tokens for failover provider %q", name)
+		}
+		chain = append(chain, domain)
+	}
+	p.failover = chain
+	return nil
 }
 
-// CurrentToken returns the current token for the first provider
-// Used by supervisor mode for single-provider supervision
-func (p *Pool) CurrentToken() *Token {
+// Failover returns the names of the failover chain's providers, in order
+func (p *Pool) Failover() []string {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Get first provider (supervisor mode uses single provider)
-	for _, pp := range p.providers {
-		if len(pp.tokens) == 0 {
-			return nil
+	var names []string
+	for _, domain := range p.failover {
+		names = append(names, p.providers[domain].provider.Name)
+	}
+	return names
+}
+
+// NextFailover returns the provider after the active one in the failover
+// chain, wrapping around, that has a token not cooling down. Returns nil if
+// the active provider isn't in the chain or no other provider is usable.
+func (p *Pool) NextFailover() *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	at := -1
+	for i, domain := range p.failover {
+		if domain == p.active {
+			at = i
+		}
+	}
+	if at < 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for step := 1; step < len(p.failover); step++ {
+		pp := p.providers[p.failover[(at+step)%len(p.failover)]]
+		for i := range pp.tokens {
+			if !pp.cooling(i, now) {
+				return pp.provider
+			}
 		}
-		return &Token{
-			Value:    pp.tokens[pp.index],
-			Provider: pp.provider,
+	}
+	return nil
+}
+
+// LocalFallback returns the first local server provider in the pool, or
+// nil if there is none
+func (p *Pool) LocalFallback() *Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, domain := range p.order {
+		if provider := p.providers[domain].provider; provider.Local {
+			return provider
 		}
 	}
 	return nil
 }
 
-// CurrentIndex returns the current token index for the first provider
-func (p *Pool) CurrentIndex() int {
+// TotalTokenCount returns the total number of tokens (alias for TokenCount)
+func (p *Pool) TotalTokenCount() int {
+	return p.TokenCount()
+}
+
+// TokenCountFor returns the number of tokens for the given domain
+func (p *Pool) TokenCountFor(domain string) int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for _, pp := range p.providers {
+	if pp := p.providers[domain]; pp != nil {
+		return len(pp.tokens)
+	}
+	return 0
+}
+
+// CurrentTokenFor returns the current token for the given domain
+func (p *Pool) CurrentTokenFor(domain string) *Token {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pp := p.providers[domain]
+	if pp == nil || len(pp.tokens) == 0 {
+		return nil
+	}
+	return pp.token(pp.index)
+}
+
+// CurrentIndexFor returns the current token index for the given domain
+func (p *Pool) CurrentIndexFor(domain string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pp := p.providers[domain]; pp != nil {
 		return pp.index
 	}
 	return 0
 }
 
-// Next rotates to the next token and returns it
-func (p *Pool) Next() *Token {
+// NextFor rotates the given domain to its next token that is not cooling
+// down and returns it. Returns nil, leaving the cursor alone, if every other
+// token is cooling down.
+func (p *Pool) NextFor(domain string) *Token {
+	view := p.fetchLeases()
+
+	p.mu.Lock()
+	p.adoptLocked(view)
+	token, move := p.nextLocked(domain, view)
+	var snapshot *stateSnapshot
+	if token != nil {
+		snapshot = p.snapshotLocked()
+	}
+	p.mu.Unlock()
+
+	// Lease and save outside the lock: NextFor is on the proxy's request path
+	p.commitLease(move)
+	p.persist(snapshot)
+	return token
+}
+
+// nextLocked rotates domain to its next token, returning the lease change
+// to commit once p.mu is released. Callers must hold p.mu.
+func (p *Pool) nextLocked(domain string, view *leaseView) (*Token, leaseMove) {
+	pp := p.providers[domain]
+	if pp == nil {
+		return nil, leaseMove{}
+	}
+
+	i := pp.pending
+	if i < 0 || i == pp.index || pp.cooling(i, time.Now()) {
+		i = pp.choose(p.strategy, view, time.Now())
+	}
+	if i < 0 {
+		return nil, leaseMove{}
+	}
+
+	move := p.moveLocked(pp, pp.index, i)
+	pp.rotated = true
+	pp.index = i
+	pp.pending = -1
+	pp.stateOf(pp.tokens[i].Value).lastUsed = time.Now()
+	return pp.token(i), move
+}
+
+// RetryTokenFor returns a token to retry one request with after used was
+// rate limited: the current token if it is usable and isn't used, else the
+// one NextFor would pick. The cursor, pending choice and leases are left
+// alone; rotating is up to whoever watches the limits. Returns nil if
+// every other token is cooling down.
+func (p *Pool) RetryTokenFor(domain, used string) *Token {
+	view := p.fetchLeases()
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for _, pp := range p.providers {
-		// Advance to next token
-		pp.index = (pp.index + 1) % len(pp.tokens)
-		return &Token{
-			Value:    pp.tokens[pp.index],
-			Provider: pp.provider,
+	p.adoptLocked(view)
+	pp := p.providers[domain]
+	if pp == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if pp.tokens[pp.index].Value != used && !pp.cooling(pp.index, now) {
+		return pp.token(pp.index)
+	}
+	i := pp.choose(p.strategy, view, now)
+	if i < 0 || pp.tokens[i].Value == used {
+		return nil
+	}
+	return pp.token(i)
+}
+
+// PeekFor returns the token NextFor would rotate to without advancing.
+// Returns nil if the provider has no other token to rotate to.
+func (p *Pool) PeekFor(domain string) *Token {
+	view := p.fetchLeases()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.adoptLocked(view)
+	pp := p.providers[domain]
+	if pp == nil {
+		return nil
+	}
+
+	i := pp.choose(p.strategy, view, time.Now())
+	if i < 0 {
+		return nil
+	}
+	pp.pending = i
+	return pp.token(i)
+}
+
+// RecordStatus stores the latest limits seen for a token. An exhausted
+// token is cooled down until its reset time. If the leaser wants statuses
+// (e.g. the daemon's broker client), changed ones are sent there too, off
+// the caller's path.
+func (p *Pool) RecordStatus(value string, status *RateLimitStatus) {
+	p.mu.Lock()
+
+	st := p.stateFor(value)
+	if st == nil {
+		p.mu.Unlock()
+		return
+	}
+
+	copied := *status
+	st.status = &copied
+	if status.Exhausted() && status.ResetTime.After(st.coolingUntil) {
+		st.coolingUntil = status.ResetTime
+	}
+
+	reporter, _ := p.leaser.(StatusReporter)
+	p.mu.Unlock()
+
+	if reporter != nil {
+		p.queueReport(reporter, TokenID(value), copied)
+	}
+}
+
+// queueReport schedules a status to be reported unless it is the one last
+// reported. Statuses queued while a report is in flight are sent together
+// afterwards, only the latest per token.
+func (p *Pool) queueReport(reporter StatusReporter, id string, status RateLimitStatus) {
+	p.reportMu.Lock()
+	defer p.reportMu.Unlock()
+
+	if last, ok := p.reported[id]; ok && last.same(&status) {
+		delete(p.pending, id)
+		return
+	}
+	p.pending[id] = status
+	if p.sending == nil {
+		p.sending = make(chan struct{})
+		go p.sendReports(reporter, p.sending)
+	}
+}
+
+// sendReports reports pending statuses until none are left, then closes done
+func (p *Pool) sendReports(reporter StatusReporter, done chan struct{}) {
+	for {
+		p.reportMu.Lock()
+		batch := p.pending
+		if len(batch) == 0 {
+			p.sending = nil
+			p.reportMu.Unlock()
+			close(done)
+			return
+		}
+		p.pending = make(map[string]RateLimitStatus)
+		p.reportMu.Unlock()
+
+		for id, status := range batch {
+			if err := reporter.ReportStatus(id, &status); err != nil {
+				log.Printf("Warning: failed to report status: %v", err)
+				continue
+			}
+			p.reportMu.Lock()
+			p.reported[id] = status
+			p.reportMu.Unlock()
 		}
 	}
-	return nil
 }
 
-// Peek returns the next token without advancing the index
+// Status returns the last known limits for a token, or nil
+func (p *Pool) Status(value string) *RateLimitStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st := p.stateFor(value)
+	if st == nil || st.status == nil {
+		return nil
+	}
+	copied := *st.status
+	return &copied
+}
+
+// CoolDown marks a token as unusable until the given time
+func (p *Pool) CoolDown(value string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if st := p.stateFor(value); st != nil && until.After(st.coolingUntil) {
+		st.coolingUntil = until
+	}
+}
+
+// CoolingUntil returns when a token stops cooling down (zero if it isn't)
+func (p *Pool) CoolingUntil(value string) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if st := p.stateFor(value); st != nil && st.coolingUntil.After(time.Now()) {
+		return st.coolingUntil
+	}
+	return time.Time{}
+}
+
+// EarliestReset returns when the first cooling token of the given domain
+// becomes usable again, or zero if none are cooling down
+func (p *Pool) EarliestReset(domain string) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pp := p.providers[domain]
+	if pp == nil {
+		return time.Time{}
+	}
+
+	now := time.Now()
+	var earliest time.Time
+	for _, t := range pp.tokens {
+		until := pp.stateOf(t.Value).coolingUntil
+		if until.After(now) && (earliest.IsZero() || until.Before(earliest)) {
+			earliest = until
+		}
+	}
+	return earliest
+}
+
+// Domains returns the domains of all providers, in insertion order
+func (p *Pool) Domains() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.order...)
+}
+
+// Lookup resolves a provider name or domain to a domain in the pool,
+// or "" if the pool has no such provider
+func (p *Pool) Lookup(name string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lookup(name)
+}
+
+// Candidates describes every token of the given domain that is not
+// cooling down, in order, for callers doing their own selection
+func (p *Pool) Candidates(domain string) []Candidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pp := p.providers[domain]
+	if pp == nil {
+		return nil
+	}
+
+	var candidates []Candidate
+	now := time.Now()
+	for i := range pp.tokens {
+		if !pp.cooling(i, now) {
+			candidates = append(candidates, pp.candidate(i))
+		}
+	}
+	return candidates
+}
+
+// Tokens returns the tokens for the given domain in rotation order
+func (p *Pool) Tokens(domain string) []*Token {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pp := p.providers[domain]
+	if pp == nil {
+		return nil
+	}
+
+	tokens := make([]*Token, len(pp.tokens))
+	for i := range pp.tokens {
+		tokens[i] = pp.token(i)
+	}
+	return tokens
+}
+
+// ActiveTokenCount returns the number of tokens for the active provider
+func (p *Pool) ActiveTokenCount() int {
+	return p.TokenCountFor(p.activeDomain())
+}
+
+// CurrentToken returns the current token for the active provider
+// Used by supervisor mode for single-provider supervision
+func (p *Pool) CurrentToken() *Token {
+	return p.CurrentTokenFor(p.activeDomain())
+}
+
+// CurrentIndex returns the current token index for the active provider
+func (p *Pool) CurrentIndex() int {
+	return p.CurrentIndexFor(p.activeDomain())
+}
+
+// Next rotates the active provider to its next token and returns it
+func (p *Pool) Next() *Token {
+	return p.NextFor(p.activeDomain())
+}
+
+// Peek returns the active provider's next token without advancing the index
 func (p *Pool) Peek() *Token {
+	return p.PeekFor(p.activeDomain())
+}
+
+// activeDomain returns the domain of the active provider
+func (p *Pool) activeDomain() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// SetLeaser makes the pool coordinate tokens with other processes
+func (p *Pool) SetLeaser(leaser Leaser) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.leaser = leaser
+}
+
+// LeaseActive leases the active provider's current token, moving to an
+// unleased one first if another process holds it. Returns false if every
+// usable token is leased elsewhere and the current one is shared.
+func (p *Pool) LeaseActive() bool {
+	p.mu.Lock()
+	pp := p.providers[p.active]
+	leaser := p.leaser
+	if pp == nil || leaser == nil || pp.provider.Local || pp.stateOf(pp.tokens[pp.index].Value).leased {
+		p.mu.Unlock()
+		return true
+	}
+
+	// The current token, else the first free one after it
+	now := time.Now()
+	candidates := []int{pp.index}
+	for step := 1; step < len(pp.tokens); step++ {
+		if i := (pp.index + step) % len(pp.tokens); !pp.cooling(i, now) {
+			candidates = append(candidates, i)
+		}
+	}
+	p.mu.Unlock()
+
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+	for _, i := range candidates {
+		ok, err := leaser.Acquire(TokenID(pp.tokens[i].Value))
+		if err != nil {
+			log.Printf("Warning: failed to lease token: %v", err)
+		}
+		if !ok {
+			continue
+		}
+
+		p.mu.Lock()
+		if i != pp.index {
+			pp.index = i
+			pp.pending = -1
+			pp.rotated = true
+			pp.stateOf(pp.tokens[i].Value).lastUsed = now
+		}
+		pp.stateOf(pp.tokens[i].Value).leased = true
+		p.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// leaseView is what other processes are doing with the pool's tokens,
+// fetched from the leaser before p.mu is taken so that no socket or file
+// round-trips happen under the lock
+type leaseView struct {
+	leased  map[string]bool      // TokenID -> held by another process
+	cooling map[string]time.Time // TokenID -> cooldown tracked centrally
+}
 
+// fetchLeases asks the leaser which tokens other processes hold. A leaser
+// that tracks tokens centrally answers in one call, cooldowns included.
+// Returns nil without a leaser.
+func (p *Pool) fetchLeases() *leaseView {
+	p.mu.Lock()
+	leaser := p.leaser
+	var ids []string
 	for _, pp := range p.providers {
-		nextIndex := (pp.index + 1) % len(pp.tokens)
-		// If we've wrapped around and only have 1 token, we can't peek
-		if len(pp.tokens) == 1 {
-			return nil
+		if pp.provider.Local {
+			continue
 		}
-		return &Token{
-			Value:    pp.tokens[nextIndex],
-			Provider: pp.provider,
+		for _, t := range pp.tokens {
+			if !pp.stateOf(t.Value).leased {
+				ids = append(ids, TokenID(t.Value))
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if leaser == nil {
+		return nil
+	}
+
+	view := &leaseView{leased: make(map[string]bool), cooling: make(map[string]time.Time)}
+	if lister, ok := leaser.(TokenLister); ok {
+		infos, err := lister.ListTokens()
+		if err == nil {
+			for _, info := range infos {
+				view.leased[info.TokenID] = info.Leased
+				view.cooling[info.TokenID] = info.CoolingUntil
+			}
+			return view
+		}
+		log.Printf("Warning: failed to list leases: %v", err)
+	}
+
+	for _, id := range ids {
+		view.leased[id] = leaser.Leased(id)
+	}
+	return view
+}
+
+// leasedElsewhere reports whether another process holds the token
+func (v *leaseView) leasedElsewhere(value string) bool {
+	return v != nil && v.leased[TokenID(value)]
+}
+
+// adoptLocked takes on cooldowns other processes reported centrally, so
+// a token exhausted elsewhere is skipped here too. Callers must hold p.mu.
+func (p *Pool) adoptLocked(view *leaseView) {
+	if view == nil || len(view.cooling) == 0 {
+		return
+	}
+	for _, pp := range p.providers {
+		for _, t := range pp.tokens {
+			st := pp.stateOf(t.Value)
+			if until := view.cooling[TokenID(t.Value)]; until.After(st.coolingUntil) {
+				st.coolingUntil = until
+			}
+		}
+	}
+}
+
+// ReleaseLeases gives up every lease this pool holds, once statuses still
+// being reported are sent
+func (p *Pool) ReleaseLeases() {
+	p.reportMu.Lock()
+	sending := p.sending
+	p.reportMu.Unlock()
+	if sending != nil {
+		<-sending
+	}
+
+	p.mu.Lock()
+	leaser := p.leaser
+	var held []string
+	for _, pp := range p.providers {
+		for _, t := range pp.tokens {
+			if st := pp.stateOf(t.Value); st.leased {
+				st.leased = false
+				held = append(held, t.Value)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+	for _, value := range held {
+		if err := leaser.Release(TokenID(value)); err != nil {
+			log.Printf("Warning: failed to release token lease: %v", err)
+		}
+	}
+}
+
+// leaseMove is a lease change decided under p.mu and committed after it
+// is released, so no socket or file I/O happens under the lock
+type leaseMove struct {
+	leaser  Leaser
+	pp      *ProviderPool
+	release string // token value whose lease to give up, or ""
+	acquire string // token value to lease, or ""
+}
+
+// moveLocked decides the lease change for moving pp's cursor from one
+// index to another. Callers must hold p.mu.
+func (p *Pool) moveLocked(pp *ProviderPool, from, to int) leaseMove {
+	if p.leaser == nil || pp.provider.Local {
+		return leaseMove{} // A local server is shared by design
+	}
+
+	move := leaseMove{leaser: p.leaser, pp: pp}
+	if st := pp.stateOf(pp.tokens[from].Value); st.leased && from != to {
+		st.leased = false
+		move.release = pp.tokens[from].Value
+	}
+	if !pp.stateOf(pp.tokens[to].Value).leased {
+		move.acquire = pp.tokens[to].Value
+	}
+	return move
+}
+
+// commitLease carries out a leaseMove. The cursor may have moved again
+// meanwhile, so it is checked before each step: a token that is current
+// again keeps its lease, and one that no longer is isn't kept.
+func (p *Pool) commitLease(move leaseMove) {
+	if move.leaser == nil {
+		return
+	}
+	p.leaseMu.Lock()
+	defer p.leaseMu.Unlock()
+
+	if move.release != "" {
+		if p.markLeased(move.pp, move.release) {
+			move.release = "" // Rotated back to it; keep the lease
+		} else if err := move.leaser.Release(TokenID(move.release)); err != nil {
+			log.Printf("Warning: failed to release token lease: %v", err)
+		}
+	}
+
+	if move.acquire == "" {
+		return
+	}
+	ok, err := move.leaser.Acquire(TokenID(move.acquire))
+	if err != nil {
+		log.Printf("Warning: failed to lease token: %v", err)
+	}
+	if ok && !p.markLeased(move.pp, move.acquire) {
+		// Rotated away while leasing; don't strand it
+		if err := move.leaser.Release(TokenID(move.acquire)); err != nil {
+			log.Printf("Warning: failed to release token lease: %v", err)
+		}
+	}
+}
+
+// markLeased records that the pool holds value's lease if value is pp's
+// current token, reporting whether it is
+func (p *Pool) markLeased(pp *ProviderPool, value string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pp.tokens[pp.index].Value != value {
+		return false
+	}
+	pp.stateOf(value).leased = true
+	return true
+}
+
+// EarliestActiveReset returns EarliestReset for the active provider
+func (p *Pool) EarliestActiveReset() time.Time {
+	return p.EarliestReset(p.activeDomain())
+}
+
+// stateFor finds the state of a token in any provider.
+// Returns nil for unknown tokens. Callers must hold p.mu.
+func (p *Pool) stateFor(value string) *tokenState {
+	for _, pp := range p.providers {
+		for _, t := range pp.tokens {
+			if t.Value == value {
+				return pp.stateOf(value)
+			}
 		}
 	}
 	return nil
 }
+
+// stateOf returns the state for one of this provider's tokens, creating it
+func (pp *ProviderPool) stateOf(value string) *tokenState {
+	st := pp.state[value]
+	if st == nil {
+		st = &tokenState{}
+		pp.state[value] = st
+	}
+	return st
+}
+
+// choose asks the strategy for the next token among those after the cursor
+// that are not cooling down, preferring tokens no other process has leased.
+// Returns -1 if there are none.
+func (pp *ProviderPool) choose(strategy Strategy, view *leaseView, now time.Time) int {
+	var candidates, leased []Candidate
+	for step := 1; step < len(pp.tokens); step++ {
+		i := (pp.index + step) % len(pp.tokens)
+		if pp.cooling(i, now) {
+			continue
+		}
+
+		c := pp.candidate(i)
+		if view.leasedElsewhere(c.Token.Value) && !pp.stateOf(c.Token.Value).leased {
+			leased = append(leased, c)
+		} else {
+			candidates = append(candidates, c)
+		}
+	}
+
+	// Share a token with another process only when nothing else is free
+	if len(candidates) == 0 {
+		candidates = leased
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	return candidates[strategy.Choose(candidates)].Index
+}
+
+// candidate describes the token at index i for a Strategy
+func (pp *ProviderPool) candidate(i int) Candidate {
+	st := pp.stateOf(pp.tokens[i].Value)
+
+	var status *RateLimitStatus
+	if st.status != nil {
+		copied := *st.status
+		status = &copied
+	}
+
+	return Candidate{
+		Index:    i,
+		Token:    pp.token(i),
+		Status:   status,
+		LastUsed: st.lastUsed,
+		Weight:   max(st.weight, 1),
+	}
+}
+
+// cooling reports whether the token at index i is cooling down
+func (pp *ProviderPool) cooling(i int, now time.Time) bool {
+	return pp.stateOf(pp.tokens[i].Value).coolingUntil.After(now)
+}
+
+// token returns a copy of the token at index i
+func (pp *ProviderPool) token(i int) *Token {
+	t := pp.tokens[i]
+	t.Provider = pp.provider
+	return &t
+}
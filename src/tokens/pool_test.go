@@ -0,0 +1,138 @@
+package tokens
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCooldownSkipsTokens(t *testing.T) {
+	for _, strategy := range []Strategy{RoundRobin{}, LeastRecentlyUsed{}, MostHeadroom{}, Weighted{}, Random{}, Sticky{}} {
+		t.Run(strategy.Name(), func(t *testing.T) {
+			pool := newTestPool(t, strategy, 4)
+			pool.CoolDown("key-1", time.Now().Add(time.Hour))
+			pool.CoolDown("key-2", time.Now().Add(time.Hour))
+
+			for _, i := range picks(pool, 6) {
+				if i != 0 && i != 3 {
+					t.Fatalf("rotated to cooling token key-%d", i)
+				}
+			}
+			for _, c := range pool.Candidates(testProvider.Domain) {
+				if c.Token.Value == "key-1" || c.Token.Value == "key-2" {
+					t.Errorf("cooling token %s offered as a candidate", c.Token.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestCooldownEverythingElse(t *testing.T) {
+	pool := newTestPool(t, RoundRobin{}, 3)
+	pool.CoolDown("key-1", time.Now().Add(time.Hour))
+	pool.CoolDown("key-2", time.Now().Add(time.Hour))
+
+	if token := pool.Next(); token != nil {
+		t.Errorf("got %s, want nil with every other token cooling down", token.Value)
+	}
+	if got := pool.CurrentIndex(); got != 0 {
+		t.Errorf("cursor moved to %d, want it left at 0", got)
+	}
+}
+
+func TestEarliestReset(t *testing.T) {
+	pool := newTestPool(t, RoundRobin{}, 3)
+	if got := pool.EarliestReset(testProvider.Domain); !got.IsZero() {
+		t.Errorf("got %v with nothing cooling, want zero", got)
+	}
+
+	soon := time.Now().Add(time.Minute)
+	pool.CoolDown("key-2", soon.Add(time.Hour))
+	pool.CoolDown("key-1", soon)
+	pool.CoolDown("key-0", soon.Add(-time.Hour)) // Already over
+
+	if got := pool.EarliestReset(testProvider.Domain); !got.Equal(soon) {
+		t.Errorf("got %v, want %v", got, soon)
+	}
+	if got := pool.EarliestReset("unknown.example"); !got.IsZero() {
+		t.Errorf("got %v for an unknown domain, want zero", got)
+	}
+}
+
+func TestCooldownExpires(t *testing.T) {
+	pool := newTestPool(t, RoundRobin{}, 2)
+	until := time.Now().Add(50 * time.Millisecond)
+	pool.CoolDown("key-1", until)
+	pool.CoolDown("key-1", until.Add(-time.Hour)) // An earlier time doesn't shorten it
+
+	if got := pool.CoolingUntil("key-1"); !got.Equal(until) {
+		t.Fatalf("CoolingUntil = %v, want %v", got, until)
+	}
+	if token := pool.Next(); token != nil {
+		t.Fatalf("rotated to %s while key-1 was cooling down", token.Value)
+	}
+
+	time.Sleep(time.Until(until) + 10*time.Millisecond)
+	if got := pool.CoolingUntil("key-1"); !got.IsZero() {
+		t.Errorf("CoolingUntil = %v after expiry, want zero", got)
+	}
+	if got := pool.EarliestReset(testProvider.Domain); !got.IsZero() {
+		t.Errorf("EarliestReset = %v after expiry, want zero", got)
+	}
+	if got := fmt.Sprint(picks(pool, 2)); got != "[1 0]" {
+		t.Errorf("got %s after expiry, want [1 0]", got)
+	}
+}
+
+func TestSetActive(t *testing.T) {
+	other := &Provider{Name: "Other", Domain: "other.example", EnvVars: []string{"OTHER_KEY"}}
+	newPool := func(t *testing.T) *Pool {
+		pool := newTestPool(t, RoundRobin{}, 2)
+		if err := pool.AddProvider(other, []string{"other-0", "other-1"}); err != nil {
+			t.Fatal(err)
+		}
+		return pool
+	}
+
+	tests := []struct {
+		name    string
+		active  string
+		want    string // Active provider afterwards
+		wantErr bool
+	}{
+		{"first added by default", "", "Test", false},
+		{"by name", "Other", "Other", false},
+		{"by name in any case", "other", "Other", false},
+		{"by domain", "other.example", "Other", false},
+		{"unknown name", "anthropic", "Test", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newPool(t)
+			if tt.active != "" {
+				err := pool.SetActive(tt.active)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+				}
+				if err != nil && !strings.Contains(err.Error(), "Test, Other") {
+					t.Errorf("error %q doesn't list the providers", err)
+				}
+			}
+
+			if got := pool.Active().Name; got != tt.want {
+				t.Errorf("active = %s, want %s", got, tt.want)
+			}
+			if got := pool.Next().Provider.Name; got != tt.want {
+				t.Errorf("Next rotated %s, want %s", got, tt.want)
+			}
+			if got := fmt.Sprint(pool.Providers()); got != "[Test Other]" {
+				t.Errorf("providers = %s, want [Test Other]", got)
+			}
+			if got := fmt.Sprint(pool.Domains()); got != "[test.example other.example]" {
+				t.Errorf("domains = %s, want [test.example other.example]", got)
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package tokens
 
+import (
+	"fmt"
+	"strings"
+)
+
 // Provider represents an AI provider configuration
 type Provider struct {
 	Name       string
@@ -7,6 +12,18 @@ type Provider struct {
 	EnvVars    []string // Environment variables to check for tokens
 	AuthHeader string   // HTTP header name for authentication
 	AuthPrefix string   // Prefix for the auth value (e.g., "Bearer ")
+
+	// Proxy mode: where the child's traffic really goes, and how to point the child at ddollar
+	BaseURL     string // Upstream API root (e.g., "https://api.anthropic.com")
+	BaseURLEnv  string // Env var the provider's SDKs read for a custom base URL
+	BaseURLPath string // Path appended to the proxy URL in BaseURLEnv (OpenAI SDKs expect "/v1")
+
+	// Per-token endpoints: env vars paired with each token var by suffix
+	// (AZURE_OPENAI_API_KEY_2 goes with AZURE_OPENAI_ENDPOINT_2)
+	EndpointEnv   string // Env var with the token's API root; tokens without one are skipped
+	DeploymentEnv string // Env var with the token's deployment name
+
+	Local bool // Keyless local server, used only once every other token is exhausted
 }
 
 // SupportedProviders is the list of supported AI providers
@@ -17,6 +34,10 @@ var SupportedProviders = []Provider{
 		EnvVars:    []string{"OPENAI_API_KEY"},
 		AuthHeader: "Authorization",
 		AuthPrefix: "Bearer ",
+
+		BaseURL:     "https://api.openai.com",
+		BaseURLEnv:  "OPENAI_BASE_URL",
+		BaseURLPath: "/v1",
 	},
 	{
 		Name:       "Anthropic",
@@ -24,6 +45,9 @@ var SupportedProviders = []Provider{
 		EnvVars:    []string{"ANTHROPIC_API_KEY"},
 		AuthHeader: "x-api-key",
 		AuthPrefix: "",
+
+		BaseURL:    "https://api.anthropic.com",
+		BaseURLEnv: "ANTHROPIC_BASE_URL",
 	},
 	{
 		Name:       "Cohere",
@@ -31,6 +55,9 @@ var SupportedProviders = []Provider{
 		EnvVars:    []string{"COHERE_API_KEY", "CO_API_KEY"},
 		AuthHeader: "Authorization",
 		AuthPrefix: "Bearer ",
+
+		BaseURL:    "https://api.cohere.ai",
+		BaseURLEnv: "CO_API_URL",
 	},
 	{
 		Name:       "Google AI",
@@ -38,9 +65,107 @@ var SupportedProviders = []Provider{
 		EnvVars:    []string{"GOOGLE_AI_API_KEY", "GOOGLE_API_KEY"},
 		AuthHeader: "x-goog-api-key",
 		AuthPrefix: "",
+
+		BaseURL: "https://generativelanguage.googleapis.com",
+	},
+
+	{
+		Name:       "Azure OpenAI",
+		Domain:     "openai.azure.com",
+		EnvVars:    []string{"AZURE_OPENAI_API_KEY"},
+		AuthHeader: "api-key",
+		AuthPrefix: "",
+
+		BaseURLEnv: "AZURE_OPENAI_ENDPOINT", // Upstream is each token's endpoint
+
+		EndpointEnv:   "AZURE_OPENAI_ENDPOINT",
+		DeploymentEnv: "AZURE_OPENAI_DEPLOYMENT",
+	},
+
+	// OpenAI-compatible APIs
+	{
+		Name:       "Mistral",
+		Domain:     "api.mistral.ai",
+		EnvVars:    []string{"MISTRAL_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL: "https://api.mistral.ai",
+	},
+	{
+		Name:       "Groq",
+		Domain:     "api.groq.com",
+		EnvVars:    []string{"GROQ_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL:    "https://api.groq.com",
+		BaseURLEnv: "GROQ_BASE_URL",
+	},
+	{
+		Name:       "Together",
+		Domain:     "api.together.xyz",
+		EnvVars:    []string{"TOGETHER_API_KEY", "TOGETHER_AI_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL:     "https://api.together.xyz",
+		BaseURLEnv:  "TOGETHER_BASE_URL",
+		BaseURLPath: "/v1",
+	},
+	{
+		Name:       "DeepSeek",
+		Domain:     "api.deepseek.com",
+		EnvVars:    []string{"DEEPSEEK_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL: "https://api.deepseek.com",
+	},
+	{
+		Name:       "xAI",
+		Domain:     "api.x.ai",
+		EnvVars:    []string{"XAI_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL: "https://api.x.ai",
+	},
+	{
+		Name:       "OpenRouter",
+		Domain:     "openrouter.ai",
+		EnvVars:    []string{"OPENROUTER_API_KEY"},
+		AuthHeader: "Authorization",
+		AuthPrefix: "Bearer ",
+
+		BaseURL: "https://openrouter.ai",
 	},
 }
 
+// RegisterProvider adds a provider to SupportedProviders, replacing a
+// built-in with the same name. Discovery, the pool and proxy mode treat it
+// like any other; its limit checker is registered separately.
+func RegisterProvider(p Provider) error {
+	if p.Name == "" || p.Domain == "" {
+		return fmt.Errorf("provider needs a name and a domain")
+	}
+	if len(p.EnvVars) == 0 {
+		return fmt.Errorf("provider %s needs at least one env var", p.Name)
+	}
+
+	for i, existing := range SupportedProviders {
+		if strings.EqualFold(existing.Name, p.Name) {
+			SupportedProviders[i] = p
+			return nil
+		}
+		if strings.EqualFold(existing.Domain, p.Domain) {
+			return fmt.Errorf("provider %s uses the same domain as %s", p.Name, existing.Name)
+		}
+	}
+	SupportedProviders = append(SupportedProviders, p)
+	return nil
+}
+
 // GetProviderByDomain returns the provider for a given domain
 func GetProviderByDomain(domain string) *Provider {
 	for _, p := range SupportedProviders {
@@ -50,3 +175,20 @@ func GetProviderByDomain(domain string) *Provider {
 	}
 	return nil
 }
+
+// GetProviderByName returns the provider with the given name or domain,
+// ignoring case
+func GetProviderByName(name string) *Provider {
+	for _, p := range SupportedProviders {
+		if strings.EqualFold(p.Name, name) || strings.EqualFold(p.Domain, name) {
+			return &p
+		}
+	}
+	return nil
+}
+
+// TokenFromHeader extracts the token value from an auth header value,
+// stripping the provider's prefix
+func (p *Provider) TokenFromHeader(value string) string {
+	return strings.TrimPrefix(value, p.AuthPrefix)
+}
@@ -0,0 +1,331 @@
+package tokens
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// stateVersion is bumped when the state file format changes incompatibly
+const stateVersion = 1
+
+// poolState is the on-disk form of the pool. Tokens are keyed by TokenID so
+// the file never contains a secret. Entries for tokens not loaded in this
+// run are kept, so runs with different keys don't erase each other's state.
+type poolState struct {
+	Version   int                           `json:"version"`
+	Providers map[string]*providerStateFile `json:"providers"` // domain -> cursor
+	Tokens    map[string]*tokenStateFile    `json:"tokens"`    // TokenID -> state
+}
+
+type providerStateFile struct {
+	Current string `json:"current"` // TokenID of the current token
+}
+
+type tokenStateFile struct {
+	CoolingUntil time.Time        `json:"cooling_until"`
+	LastUsed     time.Time        `json:"last_used"`
+	LastStatus   *RateLimitStatus `json:"last_status,omitempty"`
+	Usage        Usage            `json:"usage"` // lifetime, across runs
+}
+
+// TokenID returns a stable identifier for a token that does not reveal it
+func TokenID(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// StateDir returns ddollar's state directory: $XDG_STATE_HOME/ddollar,
+// falling back to ~/.local/state/ddollar (or the local app data dir on Windows)
+func StateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ddollar")
+	}
+	if runtime.GOOS == "windows" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			return filepath.Join(dir, "ddollar")
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "ddollar")
+	}
+	return filepath.Join(os.TempDir(), "ddollar")
+}
+
+// DefaultStatePath returns the state file used unless overridden
+func DefaultStatePath() string {
+	return filepath.Join(StateDir(), "state.json")
+}
+
+// stateLockTimeout bounds how long a save waits for another process to
+// finish writing the state file
+const stateLockTimeout = 5 * time.Second
+
+// stateSnapshot is this run's view of its own tokens, taken under p.mu and
+// merged into the state file outside it. Usage holds ledger totals for this
+// run; only the part not yet flushed is added to the file.
+type stateSnapshot struct {
+	seq   uint64
+	state poolState
+}
+
+// LoadState restores cursors, cooldowns and last known limits from path,
+// and saves back to it after every rotation. A missing file is not an
+// error; an unreadable one leaves persistence disabled rather than
+// overwriting it.
+func (p *Pool) LoadState(path string) error {
+	saved, err := readState(path)
+	if err != nil {
+		return err
+	}
+	view := p.fetchLeases()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.adoptLocked(view)
+
+	now := time.Now()
+	for domain, pp := range p.providers {
+		if pp.provider.Local {
+			continue // The server URL is not a token to keep state for
+		}
+		for i, t := range pp.tokens {
+			entry := saved.Tokens[TokenID(t.Value)]
+			if entry == nil {
+				continue
+			}
+
+			st := pp.stateOf(t.Value)
+			st.coolingUntil = entry.CoolingUntil
+			st.lastUsed = entry.LastUsed
+			st.status = entry.LastStatus
+
+			if cursor := saved.Providers[domain]; cursor != nil && cursor.Current == TokenID(t.Value) {
+				pp.index = i
+			}
+		}
+
+		// Don't resume on a token that is still cooling down
+		if pp.cooling(pp.index, now) {
+			if i := pp.choose(p.strategy, view, now); i >= 0 {
+				pp.index = i
+			}
+		}
+	}
+
+	p.statePath = path
+	return nil
+}
+
+// SaveState writes the pool state, if LoadState enabled it
+func (p *Pool) SaveState() error {
+	p.mu.Lock()
+	snapshot := p.snapshotLocked()
+	p.mu.Unlock()
+
+	return p.writeState(snapshot)
+}
+
+// persist saves after a rotation; failures are logged, not fatal
+func (p *Pool) persist(snapshot *stateSnapshot) {
+	if err := p.writeState(snapshot); err != nil {
+		log.Printf("Warning: failed to save pool state: %v", err)
+	}
+}
+
+// snapshotLocked captures the state of this run's tokens, or returns nil if
+// persistence is off. Callers must hold p.mu.
+func (p *Pool) snapshotLocked() *stateSnapshot {
+	if p.statePath == "" {
+		return nil
+	}
+
+	p.stateSeq++
+	snapshot := &stateSnapshot{seq: p.stateSeq, state: newPoolState()}
+	for domain, pp := range p.providers {
+		if pp.provider.Local {
+			continue
+		}
+
+		// A cursor that never moved (the daemon's, say) would only
+		// overwrite one a supervisor saved
+		if pp.rotated {
+			snapshot.state.Providers[domain] = &providerStateFile{Current: TokenID(pp.tokens[pp.index].Value)}
+		}
+
+		for _, t := range pp.tokens {
+			st := pp.stateOf(t.Value)
+			snapshot.state.Tokens[TokenID(t.Value)] = &tokenStateFile{
+				CoolingUntil: st.coolingUntil,
+				LastUsed:     st.lastUsed,
+				LastStatus:   st.status,
+				Usage:        p.ledger.Get(t.Value),
+			}
+		}
+	}
+	return snapshot
+}
+
+// writeState merges a snapshot into the state file. The file is re-read
+// under a lock file first, so other runs (and the daemon) sharing it keep
+// their tokens, cooldowns and usage instead of being overwritten by a copy
+// read at startup.
+func (p *Pool) writeState(snapshot *stateSnapshot) error {
+	if snapshot == nil {
+		return nil
+	}
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if snapshot.seq <= p.written {
+		return nil // A newer snapshot is already on disk
+	}
+
+	path := p.statePath
+	unlock, err := lockState(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	saved, err := readState(path)
+	if err != nil {
+		return err
+	}
+
+	for domain, cursor := range snapshot.state.Providers {
+		saved.Providers[domain] = cursor
+	}
+	for id, ours := range snapshot.state.Tokens {
+		entry := saved.Tokens[id]
+		if entry == nil {
+			entry = &tokenStateFile{}
+			saved.Tokens[id] = entry
+		}
+
+		if ours.CoolingUntil.After(entry.CoolingUntil) {
+			entry.CoolingUntil = ours.CoolingUntil
+		}
+		if ours.LastUsed.After(entry.LastUsed) {
+			entry.LastUsed = ours.LastUsed
+		}
+		if ours.LastStatus != nil {
+			entry.LastStatus = ours.LastStatus
+		}
+		entry.Usage.Add(ours.Usage.minus(p.flushed[id]))
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+
+	p.written = snapshot.seq
+	for id, ours := range snapshot.state.Tokens {
+		p.flushed[id] = ours.Usage
+	}
+	return nil
+}
+
+// newPoolState returns an empty state
+func newPoolState() poolState {
+	return poolState{
+		Version:   stateVersion,
+		Providers: make(map[string]*providerStateFile),
+		Tokens:    make(map[string]*tokenStateFile),
+	}
+}
+
+// readState reads the state file at path. A missing file reads as empty.
+func readState(path string) (poolState, error) {
+	state := newPoolState()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	var saved poolState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return state, fmt.Errorf("%s: %w", path, err)
+	}
+	if saved.Version != stateVersion {
+		return state, fmt.Errorf("%s: unsupported state version %d", path, saved.Version)
+	}
+	if saved.Providers != nil {
+		state.Providers = saved.Providers
+	}
+	if saved.Tokens != nil {
+		state.Tokens = saved.Tokens
+	}
+	return state, nil
+}
+
+// lockState takes the lock file beside path, waiting for other processes
+// to finish their writes. Returns a function that releases it.
+func lockState(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(stateLockTimeout)
+	for {
+		f, ok, err := lockFile(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() { unlockFile(f) }, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: timed out waiting for lock", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes data to a temp file beside path and renames it
+// into place, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,122 @@
+package tokens
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOverlappingRunsMergeState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// Two runs load the same (empty) state file, sharing key-1
+	first := newTestPool(t, RoundRobin{}, 2) // key-0, key-1
+	second := NewPool()
+	if err := second.AddProvider(testProvider, []string{"key-1", "key-9"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pool := range []*Pool{first, second} {
+		if err := pool.LoadState(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cooling := time.Now().Add(time.Hour).Truncate(time.Second)
+	first.CoolDown("key-0", cooling)
+	first.Ledger().Record("key-1", Usage{Requests: 2, InputTokens: 10})
+	first.Next()
+	second.Ledger().Record("key-1", Usage{Requests: 3, OutputTokens: 7})
+	second.Next()
+
+	// Saving again only adds what was recorded since the last save
+	first.Ledger().Record("key-1", Usage{Requests: 1})
+	if err := first.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, value := range []string{"key-0", "key-1", "key-9"} {
+		if saved.Tokens[TokenID(value)] == nil {
+			t.Errorf("%s missing from merged state", value)
+		}
+	}
+	if got := saved.Tokens[TokenID("key-0")].CoolingUntil; !got.Equal(cooling) {
+		t.Errorf("key-0 cooling until %v, want %v from the first run", got, cooling)
+	}
+	want := Usage{Requests: 6, InputTokens: 10, OutputTokens: 7}
+	if got := saved.Tokens[TokenID("key-1")].Usage; got != want {
+		t.Errorf("key-1 usage %+v, want both runs' %+v", got, want)
+	}
+
+	// A new run picks up where the last writer left off, skipping the
+	// token the other run cooled down
+	third := newTestPool(t, RoundRobin{}, 2)
+	if err := third.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := third.CurrentToken().Value; got != "key-1" {
+		t.Errorf("resumed on %s, want key-1", got)
+	}
+}
+
+func TestStaleSnapshotIsNotWritten(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	pool := newTestPool(t, RoundRobin{}, 3)
+	if err := pool.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	pool.mu.Lock()
+	stale := pool.snapshotLocked()
+	pool.mu.Unlock()
+
+	pool.Next() // Saves a newer cursor
+	if err := pool.writeState(stale); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := saved.Providers[testProvider.Domain].Current; got != TokenID("key-1") {
+		t.Errorf("cursor %s, want key-1's; an older snapshot overwrote it", got)
+	}
+}
+
+func TestLocalServerIsNotSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	pool := newTestPool(t, RoundRobin{}, 2)
+	local := LocalTokens("http://localhost:11434/v1", LocalURLEnv)
+	if err := pool.AddTokens(local.Provider, local.Tokens); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.TokenCount(); got != 2 {
+		t.Errorf("counted %d tokens, want 2 without the local server", got)
+	}
+
+	pool.Ledger().Record(local.Tokens[0].Value, Usage{Requests: 1})
+	if err := pool.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := readState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Providers[local.Provider.Domain]; ok {
+		t.Error("local server's cursor was saved")
+	}
+	if saved.Tokens[TokenID(local.Tokens[0].Value)] != nil {
+		t.Error("local server's URL was saved as a token")
+	}
+}
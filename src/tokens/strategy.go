@@ -0,0 +1,186 @@
+package tokens
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Candidate describes a token a Strategy may rotate to
+type Candidate struct {
+	Index    int              // Position in the provider's token list
+	Token    *Token           // The token itself
+	Status   *RateLimitStatus // Last known limits, nil if never observed
+	LastUsed time.Time        // When the token was last made current, zero if never
+	Weight   int              // Relative share for weighted selection (at least 1)
+}
+
+// Strategy picks which token to rotate to
+type Strategy interface {
+	// Name is the value accepted by --strategy
+	Name() string
+
+	// Choose returns an index into candidates. Candidates are never empty,
+	// exclude the current token and any token cooling down, and are listed
+	// in rotation order starting just after the current token.
+	Choose(candidates []Candidate) int
+}
+
+// DefaultStrategy is used when no strategy is configured
+const DefaultStrategy = "round-robin"
+
+// strategies lists the built-in strategies by name
+var strategies = map[string]func() Strategy{
+	"round-robin": func() Strategy { return RoundRobin{} },
+	"lru":         func() Strategy { return LeastRecentlyUsed{} },
+	"headroom":    func() Strategy { return MostHeadroom{} },
+	"weighted":    func() Strategy { return Weighted{} },
+	"random":      func() Strategy { return Random{} },
+	"sticky":      func() Strategy { return Sticky{} },
+}
+
+// StrategyByName returns the built-in strategy with the given name
+func StrategyByName(name string) (Strategy, error) {
+	if newStrategy, ok := strategies[strings.ToLower(name)]; ok {
+		return newStrategy(), nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q (have: %s)", name, strings.Join(StrategyNames(), ", "))
+}
+
+// StrategyNames returns the names of the built-in strategies, sorted
+func StrategyNames() []string {
+	var names []string
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RoundRobin moves to the next token in order
+type RoundRobin struct{}
+
+// Name implements Strategy
+func (RoundRobin) Name() string { return "round-robin" }
+
+// Choose implements Strategy
+func (RoundRobin) Choose(candidates []Candidate) int {
+	return 0
+}
+
+// LeastRecentlyUsed picks the token that has gone longest without being
+// current; tokens never used come first
+type LeastRecentlyUsed struct{}
+
+// Name implements Strategy
+func (LeastRecentlyUsed) Name() string { return "lru" }
+
+// Choose implements Strategy
+func (LeastRecentlyUsed) Choose(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if c.LastUsed.Before(candidates[best].LastUsed) {
+			best = i
+		}
+	}
+	return best
+}
+
+// MostHeadroom picks the token with the largest fraction of its limits
+// left, per its last known status. Tokens never observed count as full.
+type MostHeadroom struct{}
+
+// Name implements Strategy
+func (MostHeadroom) Name() string { return "headroom" }
+
+// Choose implements Strategy
+func (MostHeadroom) Choose(candidates []Candidate) int {
+	best, bestHeadroom := 0, -1.0
+	for i, c := range candidates {
+		if h := headroom(c.Status); h > bestHeadroom {
+			best, bestHeadroom = i, h
+		}
+	}
+	return best
+}
+
+// headroom returns the fraction (0-1) of the tighter limit still available
+func headroom(s *RateLimitStatus) float64 {
+	if s == nil {
+		return 1
+	}
+	if !s.ResetTime.IsZero() && time.Now().After(s.ResetTime) {
+		return 1 // Limits have reset since this was observed
+	}
+	used := max(s.RequestsPercentUsed(), s.TokensPercentUsed())
+	return 1 - used/100
+}
+
+// Weighted picks randomly in proportion to each token's weight
+type Weighted struct {
+	Rand *rand.Rand // Source of randomness, nil for the global one
+}
+
+// Name implements Strategy
+func (Weighted) Name() string { return "weighted" }
+
+// Choose implements Strategy
+func (w Weighted) Choose(candidates []Candidate) int {
+	total := 0
+	for _, c := range candidates {
+		total += max(c.Weight, 1)
+	}
+
+	n := intN(w.Rand, total)
+	for i, c := range candidates {
+		n -= max(c.Weight, 1)
+		if n < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+// Random picks uniformly among available tokens
+type Random struct {
+	Rand *rand.Rand // Source of randomness, nil for the global one
+}
+
+// Name implements Strategy
+func (Random) Name() string { return "random" }
+
+// Choose implements Strategy
+func (r Random) Choose(candidates []Candidate) int {
+	return intN(r.Rand, len(candidates))
+}
+
+// intN returns a random int in [0, n) from source, or the global source if nil
+func intN(source *rand.Rand, n int) int {
+	if source == nil {
+		return rand.IntN(n)
+	}
+	return source.IntN(n)
+}
+
+// Sticky uses tokens in their configured order, always rotating to the
+// earliest one available: the first token is used until it is exhausted,
+// then the second, and so on. Like every strategy it only runs when the
+// current token hits the threshold, so once the first token resets it is
+// picked again at the next rotation, not switched back to right away.
+type Sticky struct{}
+
+// Name implements Strategy
+func (Sticky) Name() string { return "sticky" }
+
+// Choose implements Strategy
+func (Sticky) Choose(candidates []Candidate) int {
+	best := 0
+	for i, c := range candidates {
+		if c.Index < candidates[best].Index {
+			best = i
+		}
+	}
+	return best
+}
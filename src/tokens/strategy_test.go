@@ -0,0 +1,186 @@
+package tokens
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+var testProvider = &Provider{Name: "Test", Domain: "test.example", EnvVars: []string{"TEST_KEY"}}
+
+// newTestPool returns a pool of n tokens ("key-0".."key-n-1") using strategy
+func newTestPool(t *testing.T, strategy Strategy, n int) *Pool {
+	t.Helper()
+	values := make([]string, n)
+	for i := range values {
+		values[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	pool := NewPool()
+	pool.SetStrategy(strategy)
+	if err := pool.AddProvider(testProvider, values); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// picks rotates n times and returns the index of each token rotated to
+func picks(pool *Pool, n int) []int {
+	var got []int
+	for i := 0; i < n; i++ {
+		if pool.Next() == nil {
+			got = append(got, -1)
+			continue
+		}
+		got = append(got, pool.CurrentIndex())
+	}
+	return got
+}
+
+// used returns a status with the given percentage of requests used
+func used(percent int) *RateLimitStatus {
+	return &RateLimitStatus{
+		RequestsLimit:     100,
+		RequestsRemaining: 100 - percent,
+		ResetTime:         time.Now().Add(time.Hour),
+	}
+}
+
+func TestStrategyPickOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		statuses map[string]*RateLimitStatus
+		want     []int
+	}{
+		{
+			name:     "round-robin cycles in order",
+			strategy: RoundRobin{},
+			want:     []int{1, 2, 3, 0, 1},
+		},
+		{
+			name:     "round-robin skips exhausted tokens",
+			strategy: RoundRobin{},
+			statuses: map[string]*RateLimitStatus{"key-2": used(100)},
+			want:     []int{1, 3, 0, 1},
+		},
+		{
+			name:     "lru visits unused tokens, then the oldest",
+			strategy: LeastRecentlyUsed{},
+			want:     []int{1, 2, 3, 0, 1},
+		},
+		{
+			name:     "headroom prefers the most remaining",
+			strategy: MostHeadroom{},
+			statuses: map[string]*RateLimitStatus{
+				"key-0": used(10),
+				"key-1": used(90),
+				"key-2": used(50),
+				"key-3": used(20),
+			},
+			// From 0: 3 (80% left); from 3: 0 (90%); from 0: 3 again
+			want: []int{3, 0, 3},
+		},
+		{
+			name:     "headroom counts unobserved tokens as full",
+			strategy: MostHeadroom{},
+			statuses: map[string]*RateLimitStatus{
+				"key-1": used(5),
+				"key-3": used(1),
+			},
+			want: []int{2},
+		},
+		{
+			name:     "sticky takes the earliest available",
+			strategy: Sticky{},
+			statuses: map[string]*RateLimitStatus{"key-1": used(100)},
+			want:     []int{2, 0, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newTestPool(t, tt.strategy, 4)
+			for value, status := range tt.statuses {
+				pool.RecordStatus(value, status)
+			}
+
+			got := picks(pool, len(tt.want))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("picked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomStrategiesAreSeedable(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy func(seed uint64) Strategy
+	}{
+		{"random", func(seed uint64) Strategy { return Random{Rand: rand.New(rand.NewPCG(seed, 0))} }},
+		{"weighted", func(seed uint64) Strategy { return Weighted{Rand: rand.New(rand.NewPCG(seed, 0))} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := picks(newTestPool(t, tt.strategy(42), 5), 50)
+			second := picks(newTestPool(t, tt.strategy(42), 5), 50)
+			if fmt.Sprint(first) != fmt.Sprint(second) {
+				t.Errorf("same seed picked %v then %v", first, second)
+			}
+
+			seen := map[int]bool{}
+			for i, index := range first {
+				if index < 0 || index > 4 {
+					t.Fatalf("pick %d: index %d out of range", i, index)
+				}
+				seen[index] = true
+			}
+			if len(seen) < 3 {
+				t.Errorf("50 picks only reached tokens %v", seen)
+			}
+		})
+	}
+}
+
+func TestWeightedFollowsWeights(t *testing.T) {
+	pool := newTestPool(t, Weighted{Rand: rand.New(rand.NewPCG(7, 0))}, 3)
+	pool.SetWeight("key-2", 98)
+
+	// From key-0 the candidates are key-1 (weight 1) and key-2 (weight 98)
+	heavy := 0
+	for i := 0; i < 1000; i++ {
+		if next := pool.PeekFor(testProvider.Domain); next.Value == "key-2" {
+			heavy++
+		}
+	}
+	if heavy < 950 {
+		t.Errorf("weight 98 of 99 picked %d/1000 times", heavy)
+	}
+}
+
+func TestStickyReturnsOnlyAtNextRotation(t *testing.T) {
+	pool := newTestPool(t, Sticky{}, 3)
+
+	// key-0 hits its limit with a reset just ahead
+	exhausted := used(100)
+	exhausted.ResetTime = time.Now().Add(20 * time.Millisecond)
+	pool.RecordStatus("key-0", exhausted)
+	if got := picks(pool, 1); got[0] != 1 {
+		t.Fatalf("rotated to %d after key-0 ran out, want 1", got[0])
+	}
+
+	// Once key-0 resets the pool stays put: nothing rotates until the
+	// current token crosses the threshold
+	time.Sleep(30 * time.Millisecond)
+	if got := pool.CurrentIndex(); got != 1 {
+		t.Fatalf("current moved to %d without a rotation, want 1", got)
+	}
+
+	// The next rotation goes back to the first token
+	if got := picks(pool, 1); got[0] != 0 {
+		t.Errorf("next rotation picked %d, want 0", got[0])
+	}
+}
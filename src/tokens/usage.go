@@ -0,0 +1,66 @@
+package tokens
+
+import "sync"
+
+// Usage counts what a token has consumed
+type Usage struct {
+	Requests     int64 `json:"requests"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// minus returns u less other
+func (u Usage) minus(other Usage) Usage {
+	return Usage{
+		Requests:     u.Requests - other.Requests,
+		InputTokens:  u.InputTokens - other.InputTokens,
+		OutputTokens: u.OutputTokens - other.OutputTokens,
+	}
+}
+
+// Ledger accumulates usage per token value. It is safe for concurrent use.
+type Ledger struct {
+	mu    sync.Mutex
+	usage map[string]Usage
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{usage: make(map[string]Usage)}
+}
+
+// Record adds usage for a token
+func (l *Ledger) Record(token string, u Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := l.usage[token]
+	total.Add(u)
+	l.usage[token] = total
+}
+
+// Get returns the accumulated usage for a token
+func (l *Ledger) Get(token string) Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.usage[token]
+}
+
+// Total returns the usage summed across all tokens
+func (l *Ledger) Total() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var total Usage
+	for _, u := range l.usage {
+		total.Add(u)
+	}
+	return total
+}